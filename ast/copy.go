@@ -0,0 +1,170 @@
+package ast
+
+// Copy returns a deep copy of node, so the copy can be modified, e.g. by
+// Modify, without touching the original tree. Tokens are copied as is.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: copyIdentifier(node.Name), Value: copyExpression(node.Value)}
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+	case *BlockStatement:
+		return copyBlock(node)
+	case *WhileStatement:
+		return &WhileStatement{Token: node.Token, Condition: copyExpression(node.Condition), Body: copyBlock(node.Body)}
+	case *ForStatement:
+		return &ForStatement{
+			Token:    node.Token,
+			Key:      copyIdentifier(node.Key),
+			Value:    copyIdentifier(node.Value),
+			Iterable: copyExpression(node.Iterable),
+			Body:     copyBlock(node.Body),
+		}
+	case *ThrowStatement:
+		return &ThrowStatement{Token: node.Token, Value: copyExpression(node.Value)}
+	case *BreakStatement:
+		return &BreakStatement{Token: node.Token}
+	case *ContinueStatement:
+		return &ContinueStatement{Token: node.Token}
+
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: node.Token, Value: node.Value}
+	case *FloatLiteral:
+		return &FloatLiteral{Token: node.Token, Value: node.Value}
+	case *Boolean:
+		return &Boolean{Token: node.Token, Value: node.Value}
+	case *Null:
+		return &Null{Token: node.Token}
+	case *StringLiteral:
+		return &StringLiteral{Token: node.Token, Value: node.Value}
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    node.Token,
+			Operator: node.Operator,
+			Left:     copyExpression(node.Left),
+			Right:    copyExpression(node.Right),
+		}
+	case *AssignExpression:
+		return &AssignExpression{
+			Token:    node.Token,
+			Target:   copyExpression(node.Target),
+			Operator: node.Operator,
+			Value:    copyExpression(node.Value),
+		}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+	case *TryExpression:
+		return &TryExpression{
+			Token:   node.Token,
+			Block:   copyBlock(node.Block),
+			Param:   copyIdentifier(node.Param),
+			Catch:   copyBlock(node.Catch),
+			Finally: copyBlock(node.Finally),
+		}
+	case *FunctionLiteral:
+		return &FunctionLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+			Name:       node.Name,
+		}
+	case *MacroLiteral:
+		return &MacroLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+	case *CallExpression:
+		return &CallExpression{
+			Token:     node.Token,
+			Function:  copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments),
+			Rparen:    node.Rparen,
+		}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements), Rbracket: node.Rbracket}
+	case *IndexExpression:
+		return &IndexExpression{
+			Token:    node.Token,
+			Left:     copyExpression(node.Left),
+			Index:    copyExpression(node.Index),
+			Rbracket: node.Rbracket,
+		}
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for key, value := range node.Pairs {
+			pairs[copyExpression(key)] = copyExpression(value)
+		}
+		return &HashLiteral{Token: node.Token, Pairs: pairs, Rbrace: node.Rbrace}
+	}
+
+	return node
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	copied, _ := Copy(exp).(Expression)
+	return copied
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exps))
+	for i, e := range exps {
+		copied[i] = copyExpression(e)
+	}
+	return copied
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	copied := make([]Statement, len(stmts))
+	for i, s := range stmts {
+		copied[i], _ = Copy(s).(Statement)
+	}
+	return copied
+}
+
+func copyIdentifier(id *Identifier) *Identifier {
+	if id == nil {
+		return nil
+	}
+	copied := &Identifier{Token: id.Token, Value: id.Value}
+	if id.Unquote != nil {
+		copied.Unquote, _ = Copy(id.Unquote).(*CallExpression)
+	}
+	return copied
+}
+
+func copyIdentifiers(ids []*Identifier) []*Identifier {
+	if ids == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(ids))
+	for i, id := range ids {
+		copied[i] = copyIdentifier(id)
+	}
+	return copied
+}
+
+func copyBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	return &BlockStatement{Token: b.Token, Statements: copyStatements(b.Statements), Rbrace: b.Rbrace}
+}
@@ -0,0 +1,62 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+
+	tests := []Node{
+		one(),
+		&Program{Statements: []Statement{
+			&ExpressionStatement{Expression: &InfixExpression{Left: one(), Operator: "+", Right: one()}},
+		}},
+		&IfExpression{
+			Condition:   one(),
+			Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+		},
+		&FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body:       &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: one()}}},
+		},
+		&ForStatement{
+			Value:    &Identifier{Value: "x"},
+			Iterable: &ArrayLiteral{Elements: []Expression{one()}},
+			Body:     &BlockStatement{Statements: []Statement{&BreakStatement{}}},
+		},
+		&TryExpression{
+			Block:   &BlockStatement{Statements: []Statement{&ThrowStatement{Value: one()}}},
+			Param:   &Identifier{Value: "e"},
+			Catch:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			Finally: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+		},
+		&AssignExpression{
+			Target:   &IndexExpression{Left: &Identifier{Value: "a"}, Index: one()},
+			Operator: "+=",
+			Value:    &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}},
+		},
+	}
+
+	for _, original := range tests {
+		copied := Copy(original)
+		if !reflect.DeepEqual(original, copied) {
+			t.Errorf("copy differs. want=%#v, got=%#v", original, copied)
+		}
+
+		// modifying the copy must leave the original alone
+		Modify(copied, func(node Node) Node {
+			if integer, ok := node.(*IntegerLiteral); ok {
+				integer.Value = 2
+			}
+			return node
+		})
+		Modify(original, func(node Node) Node {
+			if integer, ok := node.(*IntegerLiteral); ok && integer.Value != 1 {
+				t.Errorf("copy shares nodes with the original: %#v", original)
+			}
+			return node
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// Dump renders the tree under node one node per line, indented by depth:
+// the node type, its position and its scalar fields, followed by its
+// children labelled with the field holding them
+//
+//	InfixExpression 1:1 Operator="+"
+//	  Left: IntegerLiteral 1:1 Value=1
+//	  Right: IntegerLiteral 1:5 Value=2
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dump(&out, "", node, 0)
+	return out.String()
+}
+
+func dump(out *bytes.Buffer, label string, node Node, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+
+	v := reflect.ValueOf(node)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		out.WriteString("nil\n")
+		return
+	}
+	v = reflect.Indirect(v)
+	out.WriteString(v.Type().Name())
+	if pos := node.Pos(); pos.IsValid() {
+		out.WriteString(" " + pos.String())
+	}
+
+	type child struct {
+		label string
+		node  Node
+	}
+	var children []child
+
+	for i := 0; i < v.NumField(); i++ {
+		field, name := v.Field(i), v.Type().Field(i).Name
+		if !v.Type().Field(i).IsExported() || field.Type() == tokenType {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if field.IsNil() {
+				continue
+			}
+			if n, ok := field.Interface().(Node); ok {
+				children = append(children, child{name, n})
+			}
+		case reflect.Slice:
+			if !field.Type().Elem().Implements(nodeType) {
+				continue
+			}
+			for j := 0; j < field.Len(); j++ {
+				children = append(children, child{fmt.Sprintf("%s[%d]", name, j), field.Index(j).Interface().(Node)})
+			}
+		case reflect.Map:
+			keys := field.MapKeys()
+			sort.Slice(keys, func(a, b int) bool {
+				return keys[a].Interface().(Node).Pos().Offset < keys[b].Interface().(Node).Pos().Offset
+			})
+			for j, key := range keys {
+				children = append(children,
+					child{fmt.Sprintf("%s[%d].Key", name, j), key.Interface().(Node)},
+					child{fmt.Sprintf("%s[%d].Value", name, j), field.MapIndex(key).Interface().(Node)},
+				)
+			}
+		case reflect.String:
+			if field.String() != "" {
+				fmt.Fprintf(out, " %s=%q", name, field.String())
+			}
+		default:
+			fmt.Fprintf(out, " %s=%v", name, field.Interface())
+		}
+	}
+	out.WriteString("\n")
+
+	for _, c := range children {
+		dump(out, c.label, c.node, depth+1)
+	}
+}
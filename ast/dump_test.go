@@ -0,0 +1,54 @@
+package ast
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	pos := func(col int) token.Position { return token.Position{Line: 1, Column: col, Offset: col - 1} }
+	ident := func(name string, col int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Pos: pos(col)}, Value: name}
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(1)},
+				Name:  ident("x", 5),
+				Value: &HashLiteral{
+					Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos(9)},
+					Pairs: map[Expression]Expression{
+						&StringLiteral{Token: token.Token{Pos: pos(20)}, Value: "b"}: &Boolean{Token: token.Token{Pos: pos(25)}, Value: false},
+						&StringLiteral{Token: token.Token{Pos: pos(10)}, Value: "a"}: &FloatLiteral{Token: token.Token{Pos: pos(15)}, Value: 1.5},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Pos: pos(30)},
+				Expression: &IfExpression{
+					Token:       token.Token{Pos: pos(30)},
+					Condition:   ident("x", 34),
+					Consequence: &BlockStatement{Token: token.Token{Pos: pos(37)}},
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1
+  Statements[0]: LetStatement 1:1
+    Name: Identifier 1:5 Value="x"
+    Value: HashLiteral 1:9
+      Pairs[0].Key: StringLiteral 1:10 Value="a"
+      Pairs[0].Value: FloatLiteral 1:15 Value=1.5
+      Pairs[1].Key: StringLiteral 1:20 Value="b"
+      Pairs[1].Value: Boolean 1:25 Value=false
+  Statements[1]: ExpressionStatement 1:30
+    Expression: IfExpression 1:30
+      Condition: Identifier 1:34 Value="x"
+      Consequence: BlockStatement 1:37
+`
+	if got := Dump(program); got != expected {
+		t.Errorf("wrong dump. got=\n%s\nwant=\n%s", got, expected)
+	}
+}
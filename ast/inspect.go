@@ -0,0 +1,107 @@
+package ast
+
+import "sort"
+
+// Inspect traverses the tree under node depth first, parents before their
+// children. It calls f(node) and, if that returns true, inspects each child
+// of node and then calls f(nil). The children are read after f(node)
+// returns, so f can change them.
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+	f(nil)
+}
+
+// children lists the child nodes of node in source order
+func children(node Node) []Node {
+	var nodes []Node
+	add := func(children ...Node) {
+		for _, child := range children {
+			if !isNil(child) {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *LetStatement:
+		add(node.Name, node.Value)
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *ThrowStatement:
+		add(node.Value)
+	case *WhileStatement:
+		add(node.Condition, node.Body)
+	case *ForStatement:
+		add(node.Key, node.Value, node.Iterable, node.Body)
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *AssignExpression:
+		add(node.Target, node.Value)
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *TryExpression:
+		add(node.Block, node.Param, node.Catch, node.Finally)
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			add(p)
+		}
+		add(node.Body)
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			add(p)
+		}
+		add(node.Body)
+	case *CallExpression:
+		add(node.Function)
+		for _, a := range node.Arguments {
+			add(a)
+		}
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			add(e)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *HashLiteral:
+		keys := make([]Expression, 0, len(node.Pairs))
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.SliceStable(keys, func(a, b int) bool { return keys[a].Pos().Offset < keys[b].Pos().Offset })
+		for _, key := range keys {
+			add(key, node.Pairs[key])
+		}
+	}
+	return nodes
+}
+
+// isNil reports whether node is nil or a nil pointer, as an optional child
+// such as a missing else block is
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return node == nil
+	case *Identifier:
+		return node == nil
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	one := &IntegerLiteral{Value: 1}
+	x := &Identifier{Value: "x"}
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: x,
+			Consequence: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &CallExpression{Function: x, Arguments: []Expression{one}}},
+			}},
+		}},
+	}}
+
+	var visited []string
+	depth := 0
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		visited = append(visited, reflect.TypeOf(node).Elem().Name()+"@"+string(rune('0'+depth)))
+		depth++
+		return true
+	})
+
+	// the missing else block is skipped
+	expected := []string{
+		"Program@0",
+		"ExpressionStatement@1",
+		"IfExpression@2",
+		"Identifier@3",
+		"BlockStatement@3",
+		"ExpressionStatement@4",
+		"CallExpression@5",
+		"Identifier@6",
+		"IntegerLiteral@6",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong order.\nwant=%q\ngot= %q", expected, visited)
+	}
+	if depth != 0 {
+		t.Errorf("f(nil) not called after every node, depth=%d", depth)
+	}
+
+	// returning false skips the children
+	count := 0
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			count++
+		}
+		_, isIf := node.(*IfExpression)
+		return !isIf
+	})
+	if count != 3 {
+		t.Errorf("wrong number of nodes inspected. got=%d, want=3", count)
+	}
+}
@@ -0,0 +1,27 @@
+// Command monkey runs Monkey scripts and the Monkey REPL.
+//
+// Usage:
+//
+//	monkey [-engine=eval|vm]                        REPL, or run the program piped to stdin
+//	monkey [-engine=eval|vm] run file.mk [args...]  run a script, - reads it from stdin
+//
+// The exit status is 0 once the program finished, 1 if it did not parse
+// or raised an error it did not catch, and 2 on a bad command line.
+package main
+
+import (
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, isTerminal(os.Stdin)))
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/vm"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// exit statuses
+const (
+	exitOK    = 0
+	exitError = 1 // a syntax or macro expansion error, or an uncaught runtime error
+	exitUsage = 2
+)
+
+const usage = `usage:
+  monkey [-engine=eval|vm]                        start the REPL, or run the program piped to stdin
+  monkey [-engine=eval|vm] run file.mk [args...]  run a script, - reads it from stdin
+  monkey [-engine=eval|vm] file.mk [args...]      run a script, as a #!/usr/bin/env monkey line does
+`
+
+// run carries out the command line args and returns the exit status.
+// interactive tells whether stdin is a terminal, which gets the REPL.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, interactive bool) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { io.WriteString(stderr, usage) }
+	engine := flags.String("engine", "eval", "backend running the programs: eval or vm")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *engine != string(repl.EngineEval) && *engine != string(repl.EngineVM) {
+		fmt.Fprintf(stderr, "unknown engine %q, use eval or vm\n", *engine)
+		return exitUsage
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		if interactive {
+			greet(stdout)
+			repl.Run(stdin, stdout, repl.Options{
+				Engine:      repl.Engine(*engine),
+				HistoryFile: historyFile(),
+			})
+			return exitOK
+		}
+		return runStdin(stdin, stdout, stderr, repl.Engine(*engine), nil)
+	}
+
+	// a script starting with #! runs as monkey [flags] file.mk [args...]
+	file, scriptArgs := args[0], args[1:]
+	if args[0] == "run" {
+		if len(args) < 2 {
+			io.WriteString(stderr, usage)
+			return exitUsage
+		}
+		file, scriptArgs = args[1], args[2:]
+	}
+	if file == "-" {
+		return runStdin(stdin, stdout, stderr, repl.Engine(*engine), scriptArgs)
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return exitError
+	}
+	// the script reads what follows it on stdin
+	streams := object.NewIO(stdin, stdout, stderr)
+	streams.Args = scriptArgs
+	return runProgram(file, string(src), repl.Engine(*engine), streams)
+}
+
+// runStdin runs the whole of stdin as one program, which then has no
+// input left to read
+func runStdin(stdin io.Reader, stdout, stderr io.Writer, engine repl.Engine, args []string) int {
+	src, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: reading stdin: %s\n", err)
+		return exitError
+	}
+	streams := object.NewIO(nil, stdout, stderr)
+	streams.Args = args
+	return runProgram("", string(src), engine, streams)
+}
+
+// runProgram runs src on engine and reports its diagnostics and uncaught
+// error to streams.Err
+func runProgram(file, src string, engine repl.Engine, streams *object.IO) int {
+	p := parser.New(lexer.NewFile(file, src))
+	program := p.ParseProgram()
+	for _, d := range p.Diagnostics() {
+		printDiagnostic(streams.Err, d)
+	}
+	if len(p.Diagnostics()) != 0 {
+		return exitError
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, diagnostics := evaluator.Expand(program, macroEnv)
+	for _, d := range diagnostics {
+		printDiagnostic(streams.Err, d)
+	}
+	if len(diagnostics) != 0 {
+		return exitError
+	}
+
+	var result object.Object
+	if engine == repl.EngineVM {
+		comp := compiler.New()
+		if err := comp.Compile(expanded); err != nil {
+			fmt.Fprintf(streams.Err, "compilation failed: %s\n", err)
+			return exitError
+		}
+		machine := vm.New(comp.Bytecode())
+		machine.SetIO(streams)
+		result = machine.Run()
+	} else {
+		env := object.NewEnvironment()
+		env.SetIO(streams)
+		result = evaluator.Eval(expanded, env)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(streams.Err, err.Traceback())
+		return exitError
+	}
+	return exitOK
+}
+
+// printDiagnostic writes d as file:line:col: severity: message
+func printDiagnostic(w io.Writer, d parser.Diagnostic) {
+	if d.Pos.IsValid() {
+		fmt.Fprintf(w, "%s: %s: %s\n", d.Pos, d.Severity, d.Message)
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+	}
+}
+
+// historyFile is where the REPL keeps its history, empty if there is no
+// home directory
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+func greet(out io.Writer) {
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Fprintf(out, "Hi %s, MONKEY Interpreter starts\n", name)
+	fmt.Fprintf(out, "Pls type some commands\n")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	hello := write("hello.mk", "#!/usr/bin/env monkey\nprint(\"hello\", args());\n")
+	echo := write("echo.mk", "print(readline())")
+	fails := write("fails.mk", "let f = fn(x) { x / 0 };\nf(1);\nprint(\"unreachable\")")
+	caught := write("caught.mk", `try { throw "x" } catch (e) { eprint(e["message"]) }`)
+	broken := write("broken.mk", "let = 1;")
+	badMacro := write("macro.mk", "let m = macro() { 1 };\nm();\nprint(\"unreachable\")")
+
+	tests := []struct {
+		args        []string
+		stdin       string
+		interactive bool
+		status      int
+		stdout      string
+		stderr      string
+	}{
+		{[]string{"run", hello}, "", false, exitOK, "hello []\n", ""},
+		{[]string{"run", hello, "a", "-b"}, "", false, exitOK, "hello [a, -b]\n", ""},
+		{[]string{"-engine=vm", "run", hello, "a"}, "", false, exitOK, "hello [a]\n", ""},
+		// the argv of a script run through its #! line
+		{[]string{hello, "a", "-b"}, "", false, exitOK, "hello [a, -b]\n", ""},
+		{[]string{"-engine=vm", hello}, "", false, exitOK, "hello []\n", ""},
+		{[]string{"-", "x"}, "print(args())", false, exitOK, "[x]\n", ""},
+		{[]string{"run", echo}, "line\n", false, exitOK, "line\n", ""},
+		{[]string{"run", caught}, "", false, exitOK, "", "x\n"},
+		{
+			[]string{"run", fails}, "", false, exitError, "",
+			"ERROR: " + fails + ":1:17: division by zero\n  in f(1), called at " + fails + ":2:1\n",
+		},
+		{
+			[]string{"-engine=vm", "run", fails}, "", false, exitError, "",
+			"ERROR: " + fails + ":1:17: division by zero\n  in f(1), called at " + fails + ":2:1\n",
+		},
+		{[]string{"run", broken}, "", false, exitError, "", broken + ":1:5: error: expected next token to be IDENT, got = instead\n"},
+		{[]string{"run", badMacro}, "", false, exitError, "", badMacro + ":2:1: error: macro m: must return a quote, got INTEGER\n"},
+		{[]string{"run", filepath.Join(dir, "missing.mk")}, "", false, exitError, "", ""},
+		{nil, "print(1 + 2);\nprint(args())", false, exitOK, "3\n[]\n", ""},
+		{[]string{"-engine=vm"}, "1 / 0", false, exitError, "", "ERROR: 1:1: division by zero\n"},
+		{[]string{"run", "-", "x"}, "print(args())", false, exitOK, "[x]\n", ""},
+		{[]string{"run"}, "", false, exitUsage, "", usage},
+		{[]string{"build", hello}, "", false, exitError, "", ""},
+		{[]string{"-engine=jit"}, "", false, exitUsage, "", "unknown engine \"jit\", use eval or vm\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr, tt.interactive)
+
+		if status != tt.status {
+			t.Errorf("%q: wrong status. got=%d, want=%d (stderr %q)", tt.args, status, tt.status, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%q: wrong stdout. got=%q, want=%q", tt.args, stdout.String(), tt.stdout)
+		}
+		// the message about a missing file comes from the os
+		if tt.stderr != "" && stderr.String() != tt.stderr {
+			t.Errorf("%q: wrong stderr. got=%q, want=%q", tt.args, stderr.String(), tt.stderr)
+		}
+	}
+}
+
+func TestRunInteractive(t *testing.T) {
+	var stdout, stderr strings.Builder
+	status := run(nil, strings.NewReader("1 + 2\n"), &stdout, &stderr, true)
+
+	if status != exitOK {
+		t.Errorf("wrong status. got=%d", status)
+	}
+	if !strings.HasSuffix(stdout.String(), ">> 3\n>> ") {
+		t.Errorf("the REPL did not run. got=%q", stdout.String())
+	}
+}
@@ -0,0 +1,272 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"monkey/token"
+	"sort"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, o := range operands {
+		fmt.Fprintf(&out, " %d", o)
+	}
+	return out.String()
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpTrue
+	OpFalse
+	OpNull
+	// OpNil pushes the absence of a value, what a let statement or an
+	// empty block evaluates to
+	OpNil
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+
+	OpMinus
+	OpBang
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpAssignLocal
+	OpEnterScope
+	OpExitScope
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+
+	OpCall
+	OpTailCall
+	OpReturnValue
+	OpClosure
+
+	OpIter
+	OpIterNext
+
+	OpQuote
+
+	OpSetupCatch
+	OpSetupFinally
+	OpEndTry
+	OpThrow
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+	OpNil:   {"OpNil", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	// jump targets are absolute offsets into the instructions
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	// globals are addressed by slot; assignments carry the binary opcode
+	// of a compound operator such as += or 0 for a plain =
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2, 1}},
+	// locals are addressed by scope depth and slot, OpSetLocal always
+	// defines in the innermost scope
+	OpGetLocal:    {"OpGetLocal", []int{1, 2}},
+	OpSetLocal:    {"OpSetLocal", []int{2}},
+	OpAssignLocal: {"OpAssignLocal", []int{1, 2, 1}},
+	// OpEnterScope opens the block scope described by a constant
+	OpEnterScope: {"OpEnterScope", []int{2}},
+	OpExitScope:  {"OpExitScope", []int{}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{1}},
+
+	OpCall: {"OpCall", []int{1}},
+	// OpTailCall replaces the current frame with the call, a call in tail
+	// position so returns straight to the caller of the current function
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpClosure:     {"OpClosure", []int{2}},
+
+	// OpIter replaces the iterable with an iterator, its operand is 1 for
+	// a loop with a single variable. OpIterNext pushes the next value and
+	// key, or pops the iterator and jumps when it is exhausted.
+	OpIter:     {"OpIter", []int{1}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	// OpQuote fills the unquote calls of a quoted constant with values
+	// from the stack
+	OpQuote: {"OpQuote", []int{2, 1}},
+
+	// OpSetupCatch and OpSetupFinally install a handler that an error
+	// raised before the matching OpEndTry unwinds to. The stack is reset
+	// and execution continues at the operand with the caught error as a
+	// hash, or for finally with the error itself, on top. OpThrow raises
+	// the value on the stack, rethrowing it if it is an error.
+	OpSetupCatch:   {"OpSetupCatch", []int{2}},
+	OpSetupFinally: {"OpSetupFinally", []int{2}},
+	OpEndTry:       {"OpEndTry", []int{}},
+	OpThrow:        {"OpThrow", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction; operands are big endian
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction and reports how
+// many bytes they took
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// SourceMap maps instruction offsets to the position of the source node
+// they were compiled from, so runtime errors can point at the source
+type SourceMap []SourceEntry
+
+type SourceEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup returns the position of the instruction at offset ip
+func (sm SourceMap) Lookup(ip int) token.Position {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > ip })
+	if i == 0 {
+		return token.Position{}
+	}
+	return sm[i-1].Pos
+}
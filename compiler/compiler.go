@@ -0,0 +1,965 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+)
+
+// Compiler lowers an ast.Program to bytecode for the vm
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the node being compiled, recorded for every
+	// emitted instruction
+	pos token.Position
+}
+
+// CompilationScope collects the instructions of the program or of one function
+type CompilationScope struct {
+	instructions code.Instructions
+	sourceMap    code.SourceMap
+	loops        []*loop
+	tries        []*tryBlock
+	// blockScopes counts the for-in and catch scopes entered at runtime
+	// where the code being compiled runs
+	blockScopes int
+}
+
+// loop tracks the jumps of break and continue statements to patch once the
+// loop is compiled
+type loop struct {
+	forIn     bool
+	breaks    []int
+	continues []int
+	// blockScopes is the number of block scopes entered in the loop body
+	blockScopes int
+}
+
+// tryBlock tracks a try expression while its protected blocks compile, so
+// a return, break or continue leaving it can remove its handlers and run
+// its finally block first
+type tryBlock struct {
+	handlers    int                 // handlers installed at this point
+	finally     *ast.BlockStatement // nil unless a finally block protects this point
+	loops       int                 // loops around the try expression
+	blockScopes int                 // block scopes around the try expression
+	symbolTable *SymbolTable        // the symbols the finally block sees
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	Constants    []object.Object
+	// Globals names the global slots
+	Globals []string
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// NewWithState creates a compiler that continues where an earlier one left
+// off, so REPL inputs can refer to globals defined by previous inputs
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Names(),
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if node == nil {
+		return nil
+	}
+
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prevPos }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileStatements(node.Statements); err != nil {
+			return err
+		}
+		// the program evaluates to its last statement, which is nothing
+		// unless that is an expression statement
+		if len(node.Statements) == 0 || !isExpressionStatement(node.Statements[len(node.Statements)-1]) {
+			c.emit(code.OpNil)
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.compileTail(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.unwindTries(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return c.errorf("break outside loop")
+		}
+		if err := c.leaveLoopBody(l); err != nil {
+			return err
+		}
+		if l.forIn {
+			// leave the iteration scope and drop the iterator
+			c.emit(code.OpExitScope)
+			c.emit(code.OpPop)
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return c.errorf("continue outside loop")
+		}
+		if err := c.leaveLoopBody(l); err != nil {
+			return err
+		}
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Null:
+		c.emit(code.OpNull)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		switch node.Operator {
+		case "&&":
+			return c.compileAnd(node)
+		case "||":
+			return c.compileOr(node)
+		}
+
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node, false)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.Identifier:
+		symbol := c.symbolTable.Resolve(node.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpGetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpGetLocal, symbol.Depth, symbol.Index)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		// compile in a stable order, map iteration is random
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.MacroLiteral:
+		// macros are expanded before compiling; a leftover definition
+		// evaluates to nothing like it does in the evaluator
+		c.emit(code.OpNil)
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return c.compileQuote(node)
+		}
+
+		return c.compileCall(node, code.OpCall)
+
+	default:
+		return c.errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+// Operators maps the binary opcodes back to their operator
+var Operators = map[code.Opcode]string{}
+
+func init() {
+	for operator, op := range infixOpcodes {
+		Operators[op] = operator
+	}
+}
+
+func (c *Compiler) compileStatements(ss []ast.Statement) error {
+	for _, s := range ss {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileCall(node *ast.CallExpression, op code.Opcode) error {
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+	for _, a := range node.Arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+	if len(node.Arguments) > 255 {
+		return c.errorf("too many arguments: %d", len(node.Arguments))
+	}
+	c.emit(op, len(node.Arguments))
+	return nil
+}
+
+// compileTail compiles an expression whose value is returned, turning the
+// calls in tail position into tail calls. Within a try expression calls
+// stay regular, so the try sees their errors.
+func (c *Compiler) compileTail(exp ast.Expression) error {
+	if len(c.scopes[c.scopeIndex].tries) > 0 {
+		return c.Compile(exp)
+	}
+
+	switch node := exp.(type) {
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return c.Compile(node)
+		}
+		prevPos := c.pos
+		c.pos = node.Pos()
+		defer func() { c.pos = prevPos }()
+		return c.compileCall(node, code.OpTailCall)
+
+	case *ast.IfExpression:
+		prevPos := c.pos
+		c.pos = node.Pos()
+		defer func() { c.pos = prevPos }()
+		return c.compileIfExpression(node, true)
+
+	default:
+		return c.Compile(exp)
+	}
+}
+
+// compileBlockValue compiles a block whose value is used, leaving the value
+// of its last statement on the stack. The last expression of a block in
+// tail position is compiled by compileTail.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement, tail bool) error {
+	if block == nil || len(block.Statements) == 0 {
+		c.emit(code.OpNil)
+		return nil
+	}
+
+	last := len(block.Statements) - 1
+	if err := c.compileStatements(block.Statements[:last]); err != nil {
+		return err
+	}
+
+	if es, ok := block.Statements[last].(*ast.ExpressionStatement); ok {
+		if tail {
+			return c.compileTail(es.Expression)
+		}
+		return c.Compile(es.Expression)
+	}
+	if err := c.Compile(block.Statements[last]); err != nil {
+		return err
+	}
+	c.emit(code.OpNil)
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression, tail bool) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence, tail); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative, tail); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileAnd short-circuits like the evaluator and leaves a boolean
+func (c *Compiler) compileAnd(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emitTruthy()
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileOr(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	c.emit(code.OpTrue)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emitTruthy()
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// emitTruthy turns the value on the stack into a boolean
+func (c *Compiler) emitTruthy() {
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	var op code.Opcode
+	if node.Operator != "=" {
+		binary, ok := infixOpcodes[node.Operator[:len(node.Operator)-1]]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		op = binary
+	}
+
+	// the value is evaluated before the target, as in the evaluator
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.symbolTable.Resolve(target.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpAssignGlobal, symbol.Index, int(op))
+		} else {
+			c.emit(code.OpAssignLocal, symbol.Depth, symbol.Index, int(op))
+		}
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex, int(op))
+
+	default:
+		return c.errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	l := c.enterLoop(false)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, end)
+	c.patchJumps(l.continues, start)
+	c.patchJumps(l.breaks, end)
+	return nil
+}
+
+// compileForStatement keeps the iterator on the stack while the loop runs.
+// Every iteration runs in a fresh block scope holding the loop variables
+// and the lets of the body, so closures capture their own iteration.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	singleVar := 0
+	if node.Key == nil {
+		singleVar = 1
+	}
+	c.emit(code.OpIter, singleVar)
+
+	next := c.emit(code.OpIterNext, 9999)
+	enterScopePos := c.emit(code.OpEnterScope, 9999)
+
+	outer := c.symbolTable
+	c.symbolTable = NewEnclosedSymbolTable(outer)
+	c.scopes[c.scopeIndex].blockScopes++
+
+	// OpIterNext leaves the key on top of the value
+	if node.Key != nil {
+		c.emit(code.OpSetLocal, c.symbolTable.Define(node.Key.Value).Index)
+	} else {
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpSetLocal, c.symbolTable.Define(node.Value.Value).Index)
+	c.declareLets(node.Body)
+
+	l := c.enterLoop(true)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	c.patchJumps(l.continues, len(c.currentInstructions()))
+	c.emit(code.OpExitScope)
+	c.scopes[c.scopeIndex].blockScopes--
+	c.emit(code.OpJump, next)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(next, end)
+	c.patchJumps(l.breaks, end)
+
+	scope := &object.CompiledScope{Locals: c.symbolTable.Names()}
+	c.symbolTable = outer
+	c.changeOperand(enterScopePos, c.addConstant(scope))
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	c.declareLets(node.Body)
+
+	if err := c.compileBlockValue(node.Body, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	locals := c.symbolTable.Names()
+	scope := c.leaveScope()
+
+	fn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		SourceMap:     scope.sourceMap,
+		NumParameters: len(node.Parameters),
+		Locals:        locals,
+		Literal:       node,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+// compileQuote stores the quoted node as a constant with every unquote and
+// unquote_splice call replaced by a placeholder unquote(i) or
+// unquote_splice(i). The unquoted expressions are compiled in order and
+// OpQuote substitutes their values at runtime.
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	if len(node.Arguments) != 1 {
+		return c.errorf("wrong number of arguments. got=%d, want=1", len(node.Arguments))
+	}
+
+	unquoted := []ast.Expression{}
+	placeholder := func(call *ast.CallExpression) *ast.CallExpression {
+		index := &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: fmt.Sprint(len(unquoted))},
+			Value: int64(len(unquoted)),
+		}
+		unquoted = append(unquoted, call.Arguments[0])
+		return &ast.CallExpression{
+			Token:     call.Token,
+			Function:  call.Function,
+			Arguments: []ast.Expression{index},
+			Rparen:    call.Rparen,
+		}
+	}
+	template := ast.Modify(ast.Copy(node.Arguments[0]), func(n ast.Node) ast.Node {
+		// an unquote call standing for a bound name
+		if id, ok := n.(*ast.Identifier); ok && id.Unquote != nil && len(id.Unquote.Arguments) == 1 {
+			id.Unquote = placeholder(id.Unquote)
+			return id
+		}
+
+		call, ok := n.(*ast.CallExpression)
+		if !ok || len(call.Arguments) != 1 {
+			return n
+		}
+		if name := call.Function.TokenLiteral(); name != "unquote" && name != "unquote_splice" {
+			return n
+		}
+		return placeholder(call)
+	})
+
+	for _, e := range unquoted {
+		if err := c.Compile(e); err != nil {
+			return err
+		}
+	}
+	if len(unquoted) > 255 {
+		return c.errorf("too many unquote calls: %d", len(unquoted))
+	}
+	c.emit(code.OpQuote, c.addConstant(&object.Quote{Node: template}), len(unquoted))
+	return nil
+}
+
+// declareLets defines the names bound by let anywhere in node up front, so
+// a closure can refer to a variable its scope defines after the closure.
+// Function literals, for-in bodies and catch blocks have scopes of their
+// own.
+func (c *Compiler) declareLets(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, s := range node.Statements {
+			c.declareLets(s)
+		}
+	case *ast.LetStatement:
+		c.symbolTable.Define(node.Name.Value)
+		c.declareLets(node.Value)
+	case *ast.ReturnStatement:
+		c.declareLets(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		c.declareLets(node.Expression)
+	case *ast.WhileStatement:
+		c.declareLets(node.Condition)
+		c.declareLets(node.Body)
+	case *ast.ForStatement:
+		c.declareLets(node.Iterable)
+	case *ast.IfExpression:
+		c.declareLets(node.Condition)
+		c.declareLets(node.Consequence)
+		c.declareLets(node.Alternative)
+	case *ast.TryExpression:
+		c.declareLets(node.Block)
+		c.declareLets(node.Finally)
+	case *ast.ThrowStatement:
+		c.declareLets(node.Value)
+	case *ast.PrefixExpression:
+		c.declareLets(node.Right)
+	case *ast.InfixExpression:
+		c.declareLets(node.Left)
+		c.declareLets(node.Right)
+	case *ast.AssignExpression:
+		c.declareLets(node.Target)
+		c.declareLets(node.Value)
+	case *ast.CallExpression:
+		c.declareLets(node.Function)
+		for _, a := range node.Arguments {
+			c.declareLets(a)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.declareLets(el)
+		}
+	case *ast.IndexExpression:
+		c.declareLets(node.Left)
+		c.declareLets(node.Index)
+	case *ast.HashLiteral:
+		for k, v := range node.Pairs {
+			c.declareLets(k)
+			c.declareLets(v)
+		}
+	}
+}
+
+func (c *Compiler) enterLoop(forIn bool) *loop {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{forIn: forIn, blockScopes: scope.blockScopes}
+	scope.loops = append(scope.loops, l)
+	return l
+}
+
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// compileTryExpression installs a finally handler around the try and catch
+// blocks and a catch handler around the try block. The finally block is
+// compiled once for the normal exit, once for an error, which it rethrows,
+// and again for every return, break and continue leaving the protected
+// blocks.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	scope := &c.scopes[c.scopeIndex]
+	t := &tryBlock{
+		finally:     node.Finally,
+		loops:       len(scope.loops),
+		blockScopes: scope.blockScopes,
+		symbolTable: c.symbolTable,
+	}
+
+	setupFinallyPos := -1
+	if node.Finally != nil {
+		setupFinallyPos = c.emit(code.OpSetupFinally, 9999)
+		t.handlers++
+	}
+	setupCatchPos := -1
+	if node.Catch != nil {
+		setupCatchPos = c.emit(code.OpSetupCatch, 9999)
+		t.handlers++
+	}
+
+	c.pushTry(t)
+	if err := c.compileBlockValue(node.Block, false); err != nil {
+		return err
+	}
+
+	if node.Catch != nil {
+		c.emit(code.OpEndTry)
+		t.handlers--
+		if node.Finally == nil {
+			c.popTry()
+		}
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		// the handler leaves the caught error on the stack
+		c.changeOperand(setupCatchPos, len(c.currentInstructions()))
+		if err := c.compileCatch(node); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	if node.Finally == nil {
+		return nil
+	}
+
+	c.popTry()
+	c.emit(code.OpEndTry)
+	if err := c.Compile(node.Finally); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the handler leaves the error on the stack to rethrow
+	c.changeOperand(setupFinallyPos, len(c.currentInstructions()))
+	if err := c.Compile(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileCatch binds the caught error in a block scope of its own, like
+// the variables of a for-in iteration
+func (c *Compiler) compileCatch(node *ast.TryExpression) error {
+	enterScopePos := c.emit(code.OpEnterScope, 9999)
+
+	outer := c.symbolTable
+	c.symbolTable = NewEnclosedSymbolTable(outer)
+	c.scopes[c.scopeIndex].blockScopes++
+
+	c.emit(code.OpSetLocal, c.symbolTable.Define(node.Param.Value).Index)
+	c.declareLets(node.Catch)
+	if err := c.compileBlockValue(node.Catch, false); err != nil {
+		return err
+	}
+
+	c.emit(code.OpExitScope)
+	c.scopes[c.scopeIndex].blockScopes--
+
+	scope := &object.CompiledScope{Locals: c.symbolTable.Names()}
+	c.symbolTable = outer
+	c.changeOperand(enterScopePos, c.addConstant(scope))
+	return nil
+}
+
+func (c *Compiler) pushTry(t *tryBlock) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, t)
+}
+
+func (c *Compiler) popTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+// leaveLoopBody emits what a break or continue does before jumping: it
+// unwinds the try expressions inside the loop and leaves the block scopes
+// entered in the loop body
+func (c *Compiler) leaveLoopBody(l *loop) error {
+	loops := len(c.scopes[c.scopeIndex].loops)
+	tries := c.scopes[c.scopeIndex].tries
+
+	outermost := len(tries)
+	for outermost > 0 && tries[outermost-1].loops >= loops {
+		outermost--
+	}
+	if err := c.unwindTries(outermost); err != nil {
+		return err
+	}
+
+	for i := c.scopes[c.scopeIndex].blockScopes; i > l.blockScopes; i-- {
+		c.emit(code.OpExitScope)
+	}
+	return nil
+}
+
+// unwindTries emits the cleanup of the try expressions a jump out of the
+// current point leaves, the innermost first, from the try at index
+// outermost on: their handlers are removed and their finally blocks run,
+// each in the scope of its try expression.
+func (c *Compiler) unwindTries(outermost int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	blockScopes := c.scopes[c.scopeIndex].blockScopes
+	symbolTable := c.symbolTable
+	defer func() {
+		c.scopes[c.scopeIndex].tries = tries
+		c.scopes[c.scopeIndex].blockScopes = blockScopes
+		c.symbolTable = symbolTable
+	}()
+
+	for i := len(tries) - 1; i >= outermost; i-- {
+		t := tries[i]
+		for j := 0; j < t.handlers; j++ {
+			c.emit(code.OpEndTry)
+		}
+		if t.finally == nil {
+			continue
+		}
+
+		for c.scopes[c.scopeIndex].blockScopes > t.blockScopes {
+			c.emit(code.OpExitScope)
+			c.scopes[c.scopeIndex].blockScopes--
+		}
+		c.symbolTable = t.symbolTable
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if err := c.Compile(t.finally); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) patchJumps(positions []int, target int) {
+	for _, pos := range positions {
+		c.changeOperand(pos, target)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	scope.sourceMap = append(scope.sourceMap, code.SourceEntry{Offset: pos, Pos: c.pos})
+	return pos
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[opPos])
+	copy(ins[opPos:], code.Make(op, operand))
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if c.pos.IsValid() {
+		msg = c.pos.String() + ": " + msg
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func isExpressionStatement(s ast.Statement) bool {
+	_, ok := s.(*ast.ExpressionStatement)
+	return ok
+}
@@ -0,0 +1,80 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+)
+
+// Symbol is a resolved name. Locals are addressed by the number of scopes
+// between the reference and the declaring scope, and a slot within it.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int
+}
+
+// SymbolTable tracks the names of one scope: the global scope, a function
+// or the body of a for-in loop
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	names []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define declares name in this scope; declaring it again returns the
+// existing symbol, as a repeated let overwrites the same binding
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// Resolve finds the innermost scope declaring name. Names nobody declares
+// are global: they may still be defined later at the top level, or be
+// builtins, which the vm checks when the global is read.
+func (s *SymbolTable) Resolve(name string) Symbol {
+	depth := 0
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			if symbol.Scope == LocalScope {
+				symbol.Depth = depth
+			}
+			return symbol
+		}
+		if table.Outer == nil {
+			return table.Define(name)
+		}
+		depth++
+	}
+	return Symbol{}
+}
+
+// Names returns the declared names in slot order
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
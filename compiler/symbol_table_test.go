@@ -0,0 +1,65 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for a. got=%+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("wrong symbol for b. got=%+v", b)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a gave a new symbol. got=%+v", again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong symbol for c. got=%+v", c)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+	second.Define("b")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: LocalScope, Index: 1, Depth: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0, Depth: 0}},
+		// unknown names become globals
+		{"d", Symbol{Name: "d", Scope: GlobalScope, Index: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := second.Resolve(tt.name); got != tt.expected {
+			t.Errorf("wrong symbol for %s. want=%+v, got=%+v", tt.name, tt.expected, got)
+		}
+	}
+
+	if got := second.Outer.Resolve("b"); got != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong symbol for outer b. got=%+v", got)
+	}
+
+	third := NewEnclosedSymbolTable(second)
+	if got := third.Resolve("c"); got.Depth != 1 || got.Index != 0 {
+		t.Errorf("wrong depth for c. got=%+v", got)
+	}
+	if got := NewEnclosedSymbolTable(third).Resolve("b"); got.Depth != 2 || got.Index != 1 {
+		t.Errorf("wrong depth for b. got=%+v", got)
+	}
+}
@@ -0,0 +1,374 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to a Monkey object. nil becomes null,
+// booleans, integers, floats and strings the object of the same kind,
+// slices and arrays become arrays and maps hashes. Pointers and interfaces
+// convert as what they point to, an object.Object converts to itself and a
+// function to a builtin as by Interpreter.RegisterFunc. A map, slice or
+// pointer holding itself cannot be converted.
+func ToObject(value interface{}) (object.Object, error) {
+	return toObject("func", value)
+}
+
+// toObject converts value, naming a function name in the errors it raises
+func toObject(name string, value interface{}) (object.Object, error) {
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	return reflectToObject(name, reflect.ValueOf(value))
+}
+
+func reflectToObject(name string, v reflect.Value) (object.Object, error) {
+	return valueToObject(name, v, map[reference]bool{})
+}
+
+// reference identifies a map, slice or pointer
+type reference struct {
+	t   reflect.Type
+	ptr uintptr
+	len int
+}
+
+// valueToObject converts v inside the maps, slices and pointers in active,
+// failing for a value that holds itself
+func valueToObject(name string, v reflect.Value, active map[reference]bool) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if !v.IsNil() {
+			ref := reference{t: v.Type(), ptr: v.Pointer()}
+			if v.Kind() == reflect.Slice {
+				ref.len = v.Len()
+			}
+			if active[ref] {
+				return nil, fmt.Errorf("cannot convert %s holding itself", v.Type())
+			}
+			active[ref] = true
+			defer delete(active, ref)
+		}
+	}
+
+	if v.IsValid() && v.Type().Implements(objectType) && !(v.Kind() == reflect.Interface && v.IsNil()) {
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return evaluator.NULL, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return valueToObject(name, v.Elem(), active)
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			element, err := valueToObject(name, v.Index(i), active)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := valueToObject(name, iter.Key(), active)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := valueToObject(name, iter.Value(), active)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Func:
+		return wrapFunc(name, v.Interface())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Monkey object", v.Type())
+	}
+}
+
+// ToGo converts a Monkey object to the Go value it naturally corresponds
+// to: int64, float64, string, bool, nil, []interface{} or
+// map[interface{}]interface{}. Other objects, such as functions, are
+// returned as they are, and so is an array or hash met again inside itself.
+func ToGo(obj object.Object) interface{} {
+	return toGo(obj, map[object.Object]bool{})
+}
+
+// toGo converts obj inside the containers in active
+func toGo(obj object.Object, active map[object.Object]bool) interface{} {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		if active[obj] {
+			return obj
+		}
+		active[obj] = true
+		defer delete(active, obj)
+	}
+
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = toGo(element, active)
+		}
+		return elements
+	case *object.Hash:
+		pairs := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs[toGo(pair.Key, active)] = toGo(pair.Value, active)
+		}
+		return pairs
+	default:
+		return obj
+	}
+}
+
+// fromObject converts obj to a Go value of type t
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			break
+		}
+		value := reflect.New(t).Elem()
+		if v := ToGo(obj); v != nil {
+			value.Set(reflect.ValueOf(v))
+		}
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*object.Integer); ok {
+			value := reflect.New(t).Elem()
+			if value.OverflowInt(i.Value) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			value.SetInt(i.Value)
+			return value, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*object.Integer); ok {
+			value := reflect.New(t).Elem()
+			if i.Value < 0 || value.OverflowUint(uint64(i.Value)) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			value.SetUint(uint64(i.Value))
+			return value, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		value := reflect.New(t).Elem()
+		switch obj := obj.(type) {
+		case *object.Float:
+			value.SetFloat(obj.Value)
+			return value, nil
+		case *object.Integer:
+			value.SetFloat(float64(obj.Value))
+			return value, nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+	case reflect.Slice:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(t), nil
+		}
+		if arr, ok := obj.(*object.Array); ok {
+			value := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+			for i, element := range arr.Elements {
+				v, err := fromObject(element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+				}
+				value.Index(i).Set(v)
+			}
+			return value, nil
+		}
+	case reflect.Map:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(t), nil
+		}
+		if hash, ok := obj.(*object.Hash); ok {
+			value := reflect.MakeMapWithSize(t, len(hash.Pairs))
+			for _, pair := range hash.SortedPairs() {
+				k, err := fromObject(pair.Key, t.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				v, err := fromObject(pair.Value, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("value of %s: %w", pair.Key.Inspect(), err)
+				}
+				value.SetMapIndex(k, v)
+			}
+			return value, nil
+		}
+	}
+
+	if obj != nil && reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", typeName(obj), t)
+}
+
+func typeName(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
+
+// wrapFunc makes a builtin calling the Go function fn
+func wrapFunc(name string, fn interface{}) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%s: not a function: %T", name, fn)
+	}
+	t := v.Type()
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	results := t.NumOut()
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("%s: function returns %d values, want at most one and an error", name, results)
+	}
+
+	params := t.NumIn()
+	if t.IsVariadic() {
+		params--
+	}
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) < params || !t.IsVariadic() && len(args) > params {
+			want := fmt.Sprint(params)
+			if t.IsVariadic() {
+				want = "at least " + want
+			}
+			return &object.Error{
+				Kind:    object.ArgumentError,
+				Message: fmt.Sprintf("wrong number of arguments to `%s`. got=%d, want=%s", name, len(args), want),
+			}
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i < params {
+				paramType = t.In(i)
+			} else {
+				paramType = t.In(params).Elem()
+			}
+			value, err := fromObject(arg, paramType)
+			if err != nil {
+				return &object.Error{
+					Kind:    object.TypeError,
+					Message: fmt.Sprintf("argument %d to `%s`: %s", i+1, name, err),
+				}
+			}
+			in[i] = value
+		}
+
+		out, panicked := call(v, in)
+		if panicked != nil {
+			return &object.Error{Message: fmt.Sprintf("error calling `%s`: %v", name, panicked)}
+		}
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				// an error raised by a script the function called passes through
+				var scriptErr *Error
+				if errors.As(err, &scriptErr) {
+					return scriptErr.Object
+				}
+				return &object.Error{Message: err.Error()}
+			}
+		}
+		if results == 0 {
+			return evaluator.NULL
+		}
+		obj, err := reflectToObject(name, out[0])
+		if err != nil {
+			return &object.Error{
+				Kind:    object.TypeError,
+				Message: fmt.Sprintf("result of `%s`: %s", name, err),
+			}
+		}
+		return obj
+	}}, nil
+}
+
+// call calls fn with in, returning what it panicked with instead of
+// passing the panic on to the script and its host
+func call(fn reflect.Value, in []reflect.Value) (out []reflect.Value, panicked interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = r
+		}
+	}()
+	return fn.Call(in), nil
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import "monkey/ast"
+
+// walkBindings walks the tree under node in source order, following the
+// scopes of the names bound in it. A let binds its name in its block, a
+// function its parameters in its body, a for loop its variables in the loop
+// body and a catch its parameter in the catch block. bind is called for
+// each identifier binding a name as the scope of the binding is entered,
+// and reports whether to bind it; bind may rename the identifier. use is
+// called for every other identifier with the binding it refers to, nil if
+// it is bound outside of node. A name bound twice in one scope refers to
+// the first binding. Names given by an unquote call are not known until the
+// quote is evaluated and are skipped.
+func walkBindings(node ast.Node, bind func(id *ast.Identifier) bool, use func(id, binder *ast.Identifier)) {
+	// scopes maps the names bound in the blocks around a node to their
+	// binders, innermost last
+	var scopes []map[string]*ast.Identifier
+	// opens holds the scopes of the bindings of functions, loops and
+	// catches, which are their blocks. The bindings are made as their node
+	// is met, before any use of an outer binding of the name among the
+	// children of the node.
+	opens := map[*ast.BlockStatement]map[string]*ast.Identifier{}
+	// binders are the identifiers that bind a name rather than use it
+	binders := map[*ast.Identifier]bool{}
+	// pushed records for each node being walked whether it opened a scope
+	var pushed []bool
+
+	declare := func(scope map[string]*ast.Identifier, ids ...*ast.Identifier) map[string]*ast.Identifier {
+		for _, id := range ids {
+			if id == nil {
+				continue
+			}
+			binders[id] = true
+			if id.Unquote != nil {
+				continue
+			}
+			if binder, ok := scope[id.Value]; ok {
+				use(id, binder)
+				continue
+			}
+			name := id.Value
+			if bind(id) {
+				scope[name] = id
+			}
+		}
+		return scope
+	}
+	lookup := func(name string) *ast.Identifier {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if binder, ok := scopes[i][name]; ok {
+				return binder
+			}
+		}
+		return nil
+	}
+
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node == nil {
+			if pushed[len(pushed)-1] {
+				scopes = scopes[:len(scopes)-1]
+			}
+			pushed = pushed[:len(pushed)-1]
+			return true
+		}
+
+		opened := false
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			scope, ok := opens[node]
+			if !ok {
+				scope = map[string]*ast.Identifier{}
+			}
+			for _, s := range node.Statements {
+				if let, ok := s.(*ast.LetStatement); ok {
+					declare(scope, let.Name)
+				}
+			}
+			scopes = append(scopes, scope)
+			opened = true
+		case *ast.FunctionLiteral:
+			opens[node.Body] = declare(map[string]*ast.Identifier{}, node.Parameters...)
+		case *ast.ForStatement:
+			opens[node.Body] = declare(map[string]*ast.Identifier{}, node.Key, node.Value)
+		case *ast.TryExpression:
+			if node.Catch != nil {
+				opens[node.Catch] = declare(map[string]*ast.Identifier{}, node.Param)
+			}
+		case *ast.Identifier:
+			if !binders[node] {
+				use(node, lookup(node.Value))
+			}
+		}
+		pushed = append(pushed, opened)
+		return true
+	})
+}
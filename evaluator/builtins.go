@@ -2,14 +2,19 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"monkey/object"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
 	"len": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -19,17 +24,31 @@ var builtins = map[string]*object.Builtin{
 				return &object.Integer{Value: int64(len(arg.Elements))}
 
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newError(object.TypeError, "argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
+	// runelen counts the characters of a string where len counts its bytes
+	"runelen": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			arg, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TypeError, "argument to `runelen` must be STRING, got %s", args[0].Type())
+			}
+			return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+		},
+	},
 	"first": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+				return newError(object.TypeError, "argument to `first` must be ARRAY, got %s", args[0].Type())
 			}
 			arr := args[0].(*object.Array)
 			if len(arr.Elements) > 0 {
@@ -41,10 +60,10 @@ var builtins = map[string]*object.Builtin{
 	"last": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+				return newError(object.TypeError, "argument to `last` must be ARRAY, got %s", args[0].Type())
 			}
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
@@ -57,10 +76,10 @@ var builtins = map[string]*object.Builtin{
 	"rest": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+				return newError(object.TypeError, "argument to `rest` must be ARRAY, got %s", args[0].Type())
 			}
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
@@ -75,10 +94,10 @@ var builtins = map[string]*object.Builtin{
 	"push": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+				return newError(object.TypeError, "argument to `push` must be ARRAY, got %s", args[0].Type())
 			}
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
@@ -91,13 +110,140 @@ var builtins = map[string]*object.Builtin{
 			return NULL
 		},
 	},
-	"puts": &object.Builtin{
+	"int": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Float:
+				// float64(math.MaxInt64) rounds up to 2^63, which is already out of range
+				if math.IsNaN(arg.Value) || arg.Value < math.MinInt64 || arg.Value >= math.MaxInt64 {
+					return newError(object.ValueError, "cannot convert %s to INTEGER", arg.Inspect())
+				}
+				return &object.Integer{Value: int64(arg.Value)}
+			case *object.String:
+				value, err := strconv.ParseInt(arg.Value, 0, 64)
+				if err != nil {
+					return newError(object.ValueError, "could not parse %q as integer", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			default:
+				return newError(object.TypeError, "argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"float": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+			case *object.Float:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError(object.ValueError, "could not parse %q as float", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return newError(object.TypeError, "argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"puts": &object.Builtin{
+		IOFn: func(streams *object.IO, args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				if _, err := fmt.Fprintln(streams.Out, arg.Inspect()); err != nil {
+					return writeError("puts", err)
+				}
 			}
 
 			return NULL
 		},
 	},
+	// print writes its arguments separated by spaces on one line, eprint
+	// does the same on the error stream
+	"print": &object.Builtin{
+		IOFn: func(streams *object.IO, args ...object.Object) object.Object {
+			return printLine(streams.Out, "print", args)
+		},
+	},
+	"eprint": &object.Builtin{
+		IOFn: func(streams *object.IO, args ...object.Object) object.Object {
+			return printLine(streams.Err, "eprint", args)
+		},
+	},
+	// readline reads the next line of the input, null once it is exhausted
+	"readline": &object.Builtin{
+		IOFn: func(streams *object.IO, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			line, err := streams.ReadLine()
+			if err == io.EOF {
+				return NULL
+			}
+			if err != nil {
+				return newError(object.IOError, "`readline` failed: %s", err)
+			}
+			return &object.String{Value: line}
+		},
+	},
+	// args returns the command line arguments of the script
+	"args": &object.Builtin{
+		IOFn: func(streams *object.IO, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			elements := make([]object.Object, len(streams.Args))
+			for i, arg := range streams.Args {
+				elements[i] = &object.String{Value: arg}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// gensym returns a quoted identifier no other identifier can clash
+	// with, for macros to unquote where they need a fresh name
+	"gensym": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+
+			prefix := "g"
+			if len(args) == 1 {
+				arg, ok := args[0].(*object.String)
+				if !ok {
+					return newError(object.TypeError, "argument to `gensym` must be STRING, got %s", args[0].Type())
+				}
+				prefix = arg.Value
+			}
+			return &object.Quote{Node: gensym(prefix)}
+		},
+	},
+}
+
+func printLine(w io.Writer, name string, args []object.Object) object.Object {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Inspect()
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(values, " ")); err != nil {
+		return writeError(name, err)
+	}
+	return NULL
+}
+
+func writeError(name string, err error) *object.Error {
+	return newError(object.IOError, "`%s` failed: %s", name, err)
 }
@@ -1,18 +1,75 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
 var (
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
 	NULL  = &object.Null{}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Eval evaluates the node; errors raised by it are stamped with its position
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := step(env); err != nil {
+		result = err
+	} else {
+		result = evalNode(node, env)
+	}
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+// EvalContext evaluates node like Eval, but aborts with a LimitError or a
+// CancelledError, which try expressions do not catch, once the evaluation
+// exceeds limits or ctx is done
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) object.Object {
+	prev := env.Budget()
+	env.SetBudget(object.NewBudget(ctx, limits))
+	defer env.SetBudget(prev)
+
+	return Eval(node, env)
+}
+
+// step charges the evaluation of a node to the budget of env, if any
+func step(env *object.Environment) *object.Error {
+	if env == nil {
+		return nil
+	}
+	if budget := env.Budget(); budget != nil {
+		return budget.Step()
+	}
+	return nil
+}
+
+// allocate charges a value the evaluation created to the budget of env,
+// if any
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if env == nil {
+		return obj
+	}
+	if budget := env.Budget(); budget != nil {
+		if err := budget.Allocate(obj); err != nil {
+			return err
+		}
+	}
+	return obj
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// for statements
 	case *ast.Program:
@@ -25,9 +82,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
+	case *ast.Null:
+		return NULL
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -36,7 +99,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(env, &object.Array{Elements: elements})
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -60,6 +123,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPrefixExpression(node.Operator, right, env)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -70,6 +136,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalInfixExpression(node.Operator, left, right, env)
 
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 
@@ -77,7 +146,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIfExpression(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := evalTail(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
@@ -91,16 +160,41 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// put the var/key:value binding into scope
 		env.Set(node.Name.Value, val)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return newThrownError(val)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Name: node.Name}
 
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(node.Arguments))
+			}
 			return quote(node.Arguments[0], env)
 		}
 
@@ -113,7 +207,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		result := applyFunction(function, args, node.Pos(), env)
+		if _, ok := function.(*object.Builtin); ok {
+			return allocate(env, result)
+		}
+		return result
 	}
 	return nil
 }
@@ -126,7 +224,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return runTailCall(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -150,14 +248,25 @@ func evalStatements(ss []ast.Statement, env *object.Environment) object.Object {
 }
 
 func evalBlockStatement(bs *ast.BlockStatement, env *object.Environment) object.Object {
+	return evalBlock(bs, env, false)
+}
+
+// evalBlock evaluates the statements of a block. When the block is in tail
+// position its final expression is evaluated by evalTail.
+func evalBlock(bs *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
 	var result object.Object
 
-	for _, s := range bs.Statements {
-		result = Eval(s, env)
+	for i, s := range bs.Statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && tail && i == len(bs.Statements)-1 {
+			result = evalTail(es.Expression, env)
+		} else {
+			result = Eval(s, env)
+		}
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -194,7 +303,7 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 
 	}
 }
@@ -218,7 +327,7 @@ func evalPrefixExpression(operator string, right object.Object, env *object.Envi
 	case "-":
 		return evalMinusOperatorExpression(right, env)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -236,30 +345,38 @@ func evalBangOperatorExpression(right object.Object, env *object.Environment) ob
 }
 
 func evalMinusOperatorExpression(right object.Object, env *object.Environment) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return newError(object.ArithmeticError, "integer overflow: -(%d)", right.Value)
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right, env)
+	case isNumber(left) && isNumber(right):
+		// mixed int/float operands are promoted to float
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		// left == right is a comparison between object.Object
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return allocate(env, evalStringInfixExpression(operator, left, right))
 
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -273,24 +390,149 @@ func evalIntegerInfixExpression(
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		if (rightVal > 0 && sum < leftVal) || (rightVal < 0 && sum > leftVal) {
+			return newOverflowError(leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		diff := leftVal - rightVal
+		if (rightVal > 0 && diff > leftVal) || (rightVal < 0 && diff < leftVal) {
+			return newOverflowError(leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: diff}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		product, ok := multiplyInt64(leftVal, rightVal)
+		if !ok {
+			return newOverflowError(leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: product}
 	case "/":
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return newOverflowError(leftVal, operator, rightVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError(object.ArithmeticError, "division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		power, ok := powerInt64(leftVal, rightVal)
+		if !ok {
+			return newOverflowError(leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: power}
 
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// multiplyInt64 returns a*b and false when the product overflows
+func multiplyInt64(a, b int64) (int64, bool) {
+	product := a * b
+	if a != 0 && (product/a != b || (a == -1 && b == math.MinInt64)) {
+		return 0, false
+	}
+	return product, true
+}
+
+// powerInt64 returns base**exp for exp >= 0 and false on overflow
+func powerInt64(base, exp int64) (int64, bool) {
+	result := int64(1)
+	ok := true
+
+	for exp > 0 {
+		if exp&1 == 1 {
+			if result, ok = multiplyInt64(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			if base, ok = multiplyInt64(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+
+	return result, true
+}
+
+func newOverflowError(left int64, operator string, right int64) *object.Error {
+	return newError(object.ArithmeticError, "integer overflow: %d %s %d", left, operator, right)
+}
+
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat widens a number object to float64; callers check isNumber first
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
 	}
 }
 
@@ -299,13 +541,116 @@ func evalStringInfixExpression(
 	left, right object.Object,
 ) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalLogicalExpression short-circuits: the right side of && and || is
+// only evaluated when the left side does not decide the result
+func evalLogicalExpression(ie *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(ie.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if ie.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if ie.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(ie.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	value := Eval(ae.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		if ae.Operator != "=" {
+			current := evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+			value = evalCompoundOperator(ae.Operator, current, value, env)
+			if isError(value) {
+				return value
+			}
+		}
+		if _, ok := env.Assign(target.Value, value); !ok {
+			return newError(object.NameError, "cannot assign to undeclared identifier: %s", target.Value)
+		}
+		return value
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		if ae.Operator != "=" {
+			current := evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+			value = evalCompoundOperator(ae.Operator, current, value, env)
+			if isError(value) {
+				return value
+			}
+		}
+		return evalIndexAssignment(left, index, value)
+
+	default:
+		return newError(object.TypeError, "cannot assign to %s", ae.Target.String())
+	}
+}
+
+// evalCompoundOperator applies the operator of `+=`, `-=` etc.
+func evalCompoundOperator(operator string, left, right object.Object, env *object.Environment) object.Object {
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), left, right, env)
+}
+
+// evalIndexAssignment stores value into an array element or a hash pair in place
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError(object.TypeError, "array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError(object.IndexError, "index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = value
+		return value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+		return value
+
+	default:
+		return newError(object.TypeError, "index assignment not supported: %s", left.Type())
+	}
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
@@ -321,6 +666,200 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, stop := loopBodyResult(Eval(ws.Body, env)); stop {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// every iteration gets its own scope, so closures capture that iteration
+	iterate := func(key, value object.Object) (object.Object, bool) {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			loopEnv.Set(fs.Key.Value, key)
+		}
+		loopEnv.Set(fs.Value.Value, value)
+		return loopBodyResult(Eval(fs.Body, loopEnv))
+	}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, e := range iterable.Elements {
+			if result, stop := iterate(&object.Integer{Value: int64(i)}, e); stop {
+				return result
+			}
+		}
+	case *object.String:
+		i := 0
+		for _, ch := range iterable.Value {
+			if result, stop := iterate(&object.Integer{Value: int64(i)}, &object.String{Value: string(ch)}); stop {
+				return result
+			}
+			i++
+		}
+	case *object.Hash:
+		for _, pair := range iterable.SortedPairs() {
+			value := pair.Value
+			if fs.Key == nil {
+				value = pair.Key
+			}
+			if result, stop := iterate(pair.Key, value); stop {
+				return result
+			}
+		}
+	default:
+		return newError(object.TypeError, "cannot iterate over %s", iterable.Type())
+	}
+
+	return nil
+}
+
+// evalTryExpression evaluates to the value of the try block or, if that
+// raised an error, of the catch block. The finally block runs however the
+// other blocks ended and only changes the outcome by ending abruptly itself.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := resolveTailCall(evalBlockStatement(te.Block, env))
+	if err, ok := result.(*object.Error); ok && !err.Catchable() {
+		return err
+	}
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.Param.Value, caughtError(err))
+		result = evalBlockStatement(te.Catch, catchEnv)
+		if te.Finally != nil {
+			result = resolveTailCall(result)
+		}
+	}
+
+	if te.Finally != nil {
+		if final := Eval(te.Finally, env); final != nil {
+			switch final.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return final
+			}
+		}
+	}
+
+	return result
+}
+
+// resolveTailCall applies a tail call returned from a protected block, so
+// the try expression sees the errors it raises
+func resolveTailCall(result object.Object) object.Object {
+	returnValue, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+	if _, ok := returnValue.Value.(*object.TailCall); !ok {
+		return result
+	}
+
+	value := runTailCall(returnValue.Value)
+	if isError(value) {
+		return value
+	}
+	return &object.ReturnValue{Value: value}
+}
+
+// newThrownError turns a thrown value into an error, which keeps the value.
+// A hash, such as a caught error, supplies the message and type; any other
+// value is the message. The types of the errors aborting an evaluation are
+// reserved.
+func newThrownError(value object.Object) *object.Error {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return &object.Error{Message: thrownMessage(value), Value: value}
+	}
+
+	err := &object.Error{Message: thrownMessage(hashField(hash, "message")), Value: value}
+	if kind, ok := hashField(hash, "type").(*object.String); ok {
+		if kind.Value == object.LimitError || kind.Value == object.CancelledError {
+			return newError(object.TypeError, "cannot throw a %s, the type is reserved", kind.Value)
+		}
+		err.Kind = kind.Value
+	}
+	return err
+}
+
+func thrownMessage(value object.Object) string {
+	switch value := value.(type) {
+	case nil:
+		return NULL.Inspect()
+	case *object.String:
+		return value.Value
+	default:
+		return value.Inspect()
+	}
+}
+
+func hashField(hash *object.Hash, name string) object.Object {
+	pair, ok := hash.Pairs[(&object.String{Value: name}).HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+// caughtError is the hash a catch block binds the error it caught to. Its
+// value is what the script threw, null for an error the interpreter raised.
+func caughtError(err *object.Error) *object.Hash {
+	trace := err.StackTrace()
+	stack := make([]object.Object, len(trace))
+	for i, line := range trace {
+		stack[i] = &object.String{Value: line}
+	}
+
+	fields := map[string]object.Object{
+		"message": &object.String{Value: err.Message},
+		"type":    &object.String{Value: err.KindName()},
+		"stack":   &object.Array{Elements: stack},
+		"value":   NULL,
+	}
+	if err.Value != nil {
+		fields["value"] = err.Value
+	}
+	pairs := make(map[object.HashKey]object.HashPair, len(fields))
+	for name, value := range fields {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// loopBodyResult tells a loop whether to stop after its body evaluated to
+// result, and what the loop itself then evaluates to
+func loopBodyResult(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return nil, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -334,8 +873,8 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -356,24 +895,177 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: %s", node.Value)
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
-		return unwrapReturnValue(evaluated)
+// evalTail evaluates an expression in tail position. A call to a Monkey
+// function is not applied but returned as a TailCall, which applyFunction
+// runs once the current function has returned.
+func evalTail(exp ast.Expression, env *object.Environment) object.Object {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		if exp.Function.TokenLiteral() == "quote" {
+			return Eval(exp, env)
+		}
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+		function := Eval(exp.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(exp.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		if fn, ok := function.(*object.Function); ok {
+			return &object.TailCall{Fn: fn, Args: args, Pos: exp.Pos()}
+		}
+		result := allocate(env, applyFunction(function, args, exp.Pos(), env))
+		if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+			err.Pos = exp.Pos()
+		}
+		return result
+
+	case *ast.IfExpression:
+		condition := Eval(exp.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return evalBlock(exp.Consequence, env, true)
+		} else if exp.Alternative != nil {
+			return evalBlock(exp.Alternative, env, true)
+		}
+		return NULL
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return Eval(exp, env)
 	}
 }
 
+// applyFunction calls fn and then every tail call it returns in a loop
+// rather than recursively. Errors leaving a Monkey function get a frame for
+// it added to their stack; a tail call replaces the frame of its caller.
+// A builtin does its I/O through the streams of env, the environment of
+// the call.
+func applyFunction(fn object.Object, args []object.Object, callPos token.Position, env *object.Environment) object.Object {
+	for {
+		switch f := fn.(type) {
+		case *object.Function:
+			if len(args) < len(f.Parameters) {
+				err := newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), len(f.Parameters))
+				err.Pos = callPos
+				return err
+			}
+			extendEnv := extendFunctionEnv(f, args)
+			if err := extendEnv.EnterCall(); err != nil {
+				err.Pos = callPos
+				return err
+			}
+			budget := extendEnv.Budget()
+			if budget != nil {
+				if err := budget.EnterCall(); err != nil {
+					extendEnv.LeaveCall()
+					err.Pos = callPos
+					return err
+				}
+			}
+			var result object.Object
+			if extendEnv.CallDepth()%callsPerStack == 0 {
+				result = onNewStack(func() object.Object {
+					return unwrapReturnValue(evalBlock(f.Body, extendEnv, true))
+				})
+			} else {
+				result = unwrapReturnValue(evalBlock(f.Body, extendEnv, true))
+			}
+			if budget != nil {
+				budget.LeaveCall()
+			}
+			extendEnv.LeaveCall()
+
+			// a body ending in a statement, such as a loop, gives nothing
+			if result == nil {
+				result = NULL
+			}
+			tail, ok := result.(*object.TailCall)
+			if !ok {
+				if err, ok := result.(*object.Error); ok {
+					err.AddFrame(object.StackFrame{
+						Function: f.Name,
+						Args:     object.SummarizeArgs(args),
+						Pos:      callPos,
+					})
+				}
+				return result
+			}
+			fn, args, callPos = tail.Fn, tail.Args, tail.Pos
+
+		case *object.Builtin:
+			return f.Call(env.IO(), args...)
+
+		default:
+			return newError(object.TypeError, "not a function: %s", fn.Type())
+		}
+	}
+}
+
+// callsPerStack is the number of nested calls evaluated on one goroutine.
+// A goroutine's stack is limited to 1GB, which object.MaxCallDepth calls
+// could exceed, so deeper calls go on on a new goroutine.
+const callsPerStack = 1 << 12
+
+// onNewStack returns eval() evaluated on a new goroutine, passing on a
+// panic of eval
+func onNewStack(eval func() object.Object) object.Object {
+	type outcome struct {
+		result    object.Object
+		panicking bool
+		panicked  interface{}
+	}
+	done := make(chan outcome)
+	go func() {
+		var o outcome
+		defer func() {
+			if !o.panicking {
+				return
+			}
+			o.panicked = recover()
+			done <- o
+		}()
+		o.panicking = true
+		o.result = eval()
+		o.panicking = false
+		done <- o
+	}()
+
+	o := <-done
+	if o.panicking {
+		panic(o.panicked)
+	}
+	return o.result
+}
+
+// Apply calls fn, a Monkey function or a builtin, with args from env
+func Apply(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	return applyFunction(fn, args, token.Position{}, env)
+}
+
+// runTailCall applies obj if it is a tail call returned outside of a
+// function, as by a return at the top level
+func runTailCall(obj object.Object) object.Object {
+	tail, ok := obj.(*object.TailCall)
+	if !ok {
+		return obj
+	}
+
+	result := applyFunction(tail.Fn, tail.Args, tail.Pos, tail.Fn.Env)
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = tail.Pos
+	}
+	return result
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
@@ -406,7 +1098,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 		hashkey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
 
 		value := Eval(valueNode, env)
@@ -418,7 +1110,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return allocate(env, &object.Hash{Pairs: pairs})
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -426,7 +1118,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObj.Pairs[key.HashKey()]
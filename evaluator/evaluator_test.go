@@ -1,11 +1,15 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -36,6 +40,68 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"10 - 0.25", 9.75},
+		{"float(3)", 3},
+		{`float("2.25")`, 2.25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNumericConversionsAndComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.99)", 3},
+		{"int(-3.99)", -3},
+		{`int("42")`, 42},
+		{`int("0x1F")`, 31},
+		{"1 < 1.5", true},
+		{"2.0 > 3", false},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+		{`int("nope")`, `could not parse "nope" as integer`},
+		{`float(true)`, "argument to `float` not supported, got BOOLEAN"},
+		{"int(1.0 / 0)", "cannot convert +Inf to INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -65,6 +131,72 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestExtendedOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -7 % 3},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"2 ** -1", 0.5},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 0.5 * 2.0 ** 0.5", 2.0000000000000004},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"0.5 >= 1", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 < 2 && 3 < 2", false},
+		{"false || 1 > 0", true},
+		{"false || false", false},
+		{"!(true && false)", true},
+		{"1 % 0", "division by zero"},
+		{"3037000500 ** 2", "integer overflow: 3037000500 ** 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// the right side would fail with an error if it were evaluated
+		{"false && undefinedName", false},
+		{"true || undefinedName", true},
+		{"let f = fn() { 1 / 0 }; 1 > 2 && f()", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -113,6 +245,97 @@ func TestReturnStatement(t *testing.T) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"while (true) { break; }; 1", 1},
+		{"while (false) { 1 / 0 }; 2", 2},
+		{"let f = fn() { while (true) { return 5; } }; f()", 5},
+		{"let f = fn(arr) { for (x in arr) { if (x > 2) { return x; } } }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(arr) { for (i, x in arr) { if (x == 30) { return i; } } }; f([10, 20, 30])", 2},
+		{"let f = fn(arr) { for (x in arr) { if (x < 3) { continue; } return x; } }; f([1, 2, 3])", 3},
+		{`let f = fn(s) { for (i, ch in s) { if (i == 3) { return ch; } } }; f("café")`, "é"},
+		{`let f = fn(h) { for (k in h) { return k; } }; f({"b": 2, "a": 1})`, "a"},
+		{`let f = fn(h) { for (k, v in h) { if (v == 2) { return k; } } }; f({"b": 2, "a": 1})`, "b"},
+		{"let f = fn() { for (x in [1, 2]) { break; return 1; }; 0 }; f()", 0},
+		{"let fs = fn(arr) { for (x in arr) { return fn() { x }; } }; fs([7, 8])()", 7},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 10; x -= 2; x *= 3; x /= 4; x %= 4; x", 2},
+		{"let x = 1; let y = 1; x = y = 5; x + y", 10},
+		{"let x = 1; x = 2", 2},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i; }; sum", 15},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x; }; sum", 6},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x", 7},
+		{"let arr = [1, 2, 3]; arr[1] = 5; arr[1]", 5},
+		{"let arr = [1, 2, 3]; arr[2] += 5; arr[2]", 8},
+		{"let a = [1]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {"a": 1}; h["a"] *= 10; h["a"]`, 10},
+		{"let a = [1]; a[0] = a; len(a[0][0][0])", 1},
+		{"y = 1", "cannot assign to undeclared identifier: y"},
+		{"len = 1", "cannot assign to undeclared identifier: len"},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+		{`let arr = [1]; arr["a"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -134,6 +357,14 @@ func TestErrorHandling(t *testing.T) {
 		{"foobar", "identifier not found: foobar"},
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
 		{`{"name": "Monkey"}[fn(x){x}];`, "unusable as hash key: FUNCTION"},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+		{"1 / 0", "division by zero"},
+		{"int(1e19)", "cannot convert 1e+19 to INTEGER"},
+		{"fn(a, b) { a }(1)", "wrong number of arguments. got=1, want=2"},
 	}
 
 	for _, tt := range tests {
@@ -151,6 +382,59 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN"},
+		{"let a = 1;\n  a + foobar;", "ERROR: 2:7: identifier not found: foobar"},
+		{"let f = fn(x) {\n  -x\n};\nf(true)", "ERROR: 2:3: unknown operator: -BOOLEAN"},
+		{`len(1)`, "ERROR: 1:1: argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		e := testEval(tt.input)
+
+		err, ok := e.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", e, e)
+			continue
+		}
+
+		if err.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestSelfReferencingContainers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{"let a = [1, 2]; a[1] = a; [a, a]", "[[1, [...]], [1, [...]]]"},
+		{`let h = {"k": 1}; h["self"] = h; h`, "{k: 1, self: {...}}"},
+		{`let h = {}; let a = [h]; h["a"] = a; a`, "[{a: [...]}]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	var out strings.Builder
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(nil, &out, &out))
+	Eval(testParseProgram("let a = [1]; a[0] = a; puts(a)"), env)
+	if out.String() != "[[...]]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
 func TestLetStatementHandling(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -220,6 +504,8 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!null", true},
+		{"null == null", true},
 	}
 
 	for _, tt := range tests {
@@ -252,6 +538,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -285,6 +584,324 @@ func TestClosures(t *testing.T) {
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)`, 1000000},
+		{`let count = fn(n) { if (n == 0) { return 7; } return count(n - 1); }; count(100000)`, 7},
+		{`let count = fn(n) { while (true) { if (n == 0) { return 0; } return count(n - 1); } }; count(100000)`, 0},
+		{`
+		let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } };
+		let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } };
+		even(100001)`, 0},
+		{`let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; return count(100000);`, 0},
+		// not in tail position, but still fine at this depth
+		{`let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(1000)`, 500500},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCallReduceOverLargeArray(t *testing.T) {
+	elements := make([]object.Object, 1000000)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: int64(i)}
+	}
+	env := object.NewEnvironment()
+	env.Set("big", &object.Array{Elements: elements})
+
+	input := `
+	let reduce = fn(arr, f, initial) {
+		let iter = fn(i, acc) {
+			if (i == len(arr)) { acc } else { iter(i + 1, f(acc, arr[i])) }
+		};
+		iter(0, initial)
+	};
+	reduce(big, fn(acc, x) { acc + x }, 0)`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 499999500000)
+}
+
+func TestTailCallErrors(t *testing.T) {
+	input := `let f = fn(a, b) { a };
+let g = fn() { f(1) };
+g()`
+
+	result := testEval(input)
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+	expected := "ERROR: 2:16: wrong number of arguments. got=1, want=2"
+	if err.Inspect() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Inspect())
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let inner = fn(x) { x / 0 };
+let outer = fn(s) { inner(len(s)) + 1 };
+outer("abc")`,
+			"ERROR: 1:21: division by zero\n" +
+				"  in inner(3), called at 2:21\n" +
+				"  in outer(\"abc\"), called at 3:1",
+		},
+		{
+			`let apply = fn(f, x) { f(x) + 0 };
+apply(fn(n) { n + true }, [1, 2])`,
+			"ERROR: 2:15: type mismatch: ARRAY + BOOLEAN\n" +
+				"  in fn([1, 2]), called at 1:24\n" +
+				"  in apply(fn, [1, 2]), called at 2:1",
+		},
+		{
+			`let f = fn(n) { if (n == 0) { missing } else { f(n - 1) } };
+f(3)`,
+			"ERROR: 1:31: identifier not found: missing\n" +
+				"  in f(0), called at 1:48",
+		},
+		{`1 + true`, "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", result, result)
+			continue
+		}
+		if err.Traceback() != tt.expected {
+			t.Errorf("wrong traceback.\nwant=%q\ngot= %q", tt.expected, err.Traceback())
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { throw "boom" } catch (e) { [e["type"], e["message"]] }`, "[Error, boom]"},
+		{`try { throw {"type": "MyError", "message": "m"} } catch (e) { e["type"] }`, "MyError"},
+		{`let f = fn() { throw "x" }; try { f() } catch (e) { e["stack"] }`, "[f(), called at 1:35]"},
+		{`let n = 0; try { n = 1 } finally { n = 2 }; n`, "2"},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, "2"},
+		{`let s = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break } } finally { s += x } } s`, "3"},
+		{`try { 1 / 0 } finally { 2 }`, "ERROR: 1:7: division by zero"},
+		{`throw "uncaught"`, "ERROR: 1:1: uncaught"},
+		{`let e = 1; try { throw "x" } catch (e) { e }; e`, "1"},
+		// a caught error keeps the value thrown
+		{`try { throw {"code": 42} } catch (e) { e["value"]["code"] }`, "42"},
+		{`try { throw 42 } catch (e) { [e["message"], e["value"] + 1] }`, "[42, 43]"},
+		{`try { 1 / 0 } catch (e) { e["value"] }`, "null"},
+		// scripts cannot raise the errors that abort an evaluation
+		{`try { throw {"type": "CancelledError", "message": "x"} } catch (e) { [e["type"], e["message"]] }`, "[TypeError, cannot throw a CancelledError, the type is reserved]"},
+		{`try { throw {"type": "LimitError"} } catch (e) { e["type"] }`, "TypeError"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if result == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestBuiltinErrorTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, object.TypeError},
+		{`len(1, 2)`, object.ArgumentError},
+		{`int("x")`, object.ValueError},
+		{`foo`, object.NameError},
+		{`[1][3] = 0`, object.IndexError},
+		{`1 / 0`, object.ArithmeticError},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, result, result)
+			continue
+		}
+		if err.Kind != tt.expected {
+			t.Errorf("wrong error type for %q. want=%q, got=%q", tt.input, tt.expected, err.Kind)
+		}
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	// without limits, as the vm does
+	result := testEval(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10000000)`)
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error. got=%T (%+v)", result, result)
+	}
+	if err.Kind != object.RecursionError || err.Message != "stack overflow: call depth exceeds 262144" {
+		t.Errorf("wrong error. got=%s %q", err.Kind, err.Message)
+	}
+	// the calls left are no longer counted
+	if result := testEval(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; try { f(300000) } catch (e) { f(200000) }`); result.Inspect() != "200000" {
+		t.Errorf("wrong result after the overflow. got=%s", result.Inspect())
+	}
+}
+
+func TestEvalContextLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{`1 + 2`, object.Limits{MaxSteps: 100, MaxCallDepth: 1, MaxAllocations: 1}, "3"},
+		{`while (true) { }`, object.Limits{MaxSteps: 1000}, "ERROR: 1:8: step limit exceeded: 1000"},
+		{
+			`let f = fn(n) { 1 + f(n + 1) }; f(0)`,
+			object.Limits{MaxCallDepth: 50},
+			"ERROR: 1:21: call depth limit exceeded: 50",
+		},
+		{
+			`let f = fn(n) { if (n == 0) { "done" } else { f(n - 1) } }; f(1000)`,
+			object.Limits{MaxCallDepth: 2},
+			"done",
+		},
+		{
+			`let s = "ab"; while (true) { s = s + s }`,
+			object.Limits{MaxAllocations: 1000},
+			"ERROR: 1:34: allocation limit exceeded: 1000",
+		},
+		{`[1, 2, 3]`, object.Limits{MaxAllocations: 2}, "ERROR: 1:1: allocation limit exceeded: 2"},
+		{
+			`let a = [1]; let i = 0; while (true) { a = push(a, i) }`,
+			object.Limits{MaxAllocations: 100},
+			"ERROR: 1:44: allocation limit exceeded: 100",
+		},
+		{
+			`try { while (true) { } } catch (e) { 1 } finally { 2 }`,
+			object.Limits{MaxSteps: 100},
+			"ERROR: 1:14: step limit exceeded: 100",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		result := EvalContext(context.Background(), program, env, tt.limits)
+		if result == nil || result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, tt.expected, result)
+		}
+		if env.Budget() != nil {
+			t.Errorf("budget left on the environment after %q", tt.input)
+		}
+	}
+}
+
+func TestEvalContextCancel(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn() { f() + 1 }; while (true) { let x = 1 }`)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+	if err.Kind != object.CancelledError || err.Message != "evaluation cancelled: context deadline exceeded" {
+		t.Errorf("wrong error. got=%q (%s)", err.Message, err.Kind)
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected interface{}
+		stdout   string
+		stderr   string
+	}{
+		{`puts("a", 1)`, "", nil, "a\n1\n", ""},
+		{`print("a", 1, [true])`, "", nil, "a 1 [true]\n", ""},
+		{`print()`, "", nil, "\n", ""},
+		{`eprint("oops", 2)`, "", nil, "", "oops 2\n"},
+		{`readline()`, "one\ntwo", "one", "", ""},
+		{`readline(); readline()`, "one\r\ntwo", "two", "", ""},
+		{`readline(); readline()`, "one\n", nil, "", ""},
+		{`let f = fn() { readline() }; f() + f()`, "a\nb\n", "ab", "", ""},
+		{`readline(1)`, "", "wrong number of arguments. got=1, want=0", "", ""},
+		{`let a = args(); a[0] + a[1]`, "", "-vfile", "", ""},
+		{`print(args())`, "", nil, "[-v, file]\n", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		env := object.NewEnvironment()
+		streams := object.NewIO(strings.NewReader(tt.stdin), &stdout, &stderr)
+		streams.Args = []string{"-v", "file"}
+		env.SetIO(streams)
+
+		result := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, result)
+		case string:
+			var got string
+			switch result := result.(type) {
+			case *object.Error:
+				got = result.Message
+			case *object.String:
+				got = result.Value
+			default:
+				t.Errorf("unexpected result for %q. got=%T (%+v)", tt.input, result, result)
+				continue
+			}
+			if got != expected {
+				t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, got, expected)
+			}
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("wrong stdout for %q. got=%q, want=%q", tt.input, stdout.String(), tt.stdout)
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("wrong stderr for %q. got=%q, want=%q", tt.input, stderr.String(), tt.stderr)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestIOBuiltinsWriteError(t *testing.T) {
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(nil, failingWriter{}, nil))
+
+	result := Eval(parser.New(lexer.New(`try { print(1) } catch (e) { e["type"] + ": " + e["message"] }`)).ParseProgram(), env)
+	str, ok := result.(*object.String)
+	if !ok || str.Value != "IOError: `print` failed: disk full" {
+		t.Errorf("wrong result. got=%T (%+v)", result, result)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -323,6 +940,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("four")`, 4},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len("café")`, 5},
+		{`runelen("café")`, 4},
+		{`runelen("🐒 monkey")`, 8},
+		{`runelen(1)`, "argument to `runelen` must be STRING, got INTEGER"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,125 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sync/atomic"
+)
+
+// gensyms counts the symbols gensym made
+var gensyms int64
+
+// gensym returns a fresh identifier named prefix#N, which the lexer never
+// produces as # does not start a token
+func gensym(prefix string) *ast.Identifier {
+	name := fmt.Sprintf("%s#%d", prefix, atomic.AddInt64(&gensyms, 1))
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+// hygienize renames the identifiers the templates of a macro body, the
+// arguments of its quote calls, bind with let, as function parameters, as
+// loop variables or as catch parameters, so that they neither capture nor
+// shadow the identifiers at the call site. Each binding gets a fresh name,
+// which replaces its name only within its scope: the block of the let, the
+// function body, the loop body or the catch block. A name marked with
+// escape(name) in a template is kept as written, which lets a macro bind a
+// name for the code passed to it. The arguments of unquote and
+// unquote_splice calls are evaluated in the macro and are left alone. body
+// is changed in place, so it must be a copy.
+func hygienize(body *ast.BlockStatement) {
+	var quotes []*ast.CallExpression
+	ast.Inspect(body, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok && isCallTo(call, "quote") && len(call.Arguments) == 1 {
+			quotes = append(quotes, call)
+		}
+		return true
+	})
+
+	// set the unquote arguments aside while walking the templates, a
+	// template quoted within them is one of the templates itself
+	unquoted := map[*ast.CallExpression][]ast.Expression{}
+	escaped := map[string]bool{}
+	for _, q := range quotes {
+		ast.Inspect(q.Arguments[0], func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+			if isUnquoteCall(call) || isUnquoteSpliceCall(call) {
+				if _, seen := unquoted[call]; !seen {
+					unquoted[call] = call.Arguments
+					call.Arguments = nil
+				}
+			}
+			if id, ok := escapedIdentifier(call); ok {
+				escaped[id.Value] = true
+			}
+			return true
+		})
+	}
+
+	// a template quoted within another one is renamed with it
+	renamed := map[*ast.CallExpression]bool{}
+	for _, q := range quotes {
+		if renamed[q] {
+			continue
+		}
+		renameBindings(q.Arguments[0], escaped, renamed)
+		q.Arguments[0], _ = ast.Modify(q.Arguments[0], func(node ast.Node) ast.Node {
+			if call, ok := node.(*ast.CallExpression); ok {
+				if id, ok := escapedIdentifier(call); ok {
+					return id
+				}
+			}
+			return node
+		}).(ast.Expression)
+	}
+
+	for call, args := range unquoted {
+		call.Arguments = args
+	}
+}
+
+// renameBindings renames the names bound in template, except the escaped
+// ones, and their uses within the scope of each binding. It adds the quote
+// calls within template to quotes.
+func renameBindings(template ast.Node, escaped map[string]bool, quotes map[*ast.CallExpression]bool) {
+	ast.Inspect(template, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok && isCallTo(call, "quote") {
+			quotes[call] = true
+		}
+		return true
+	})
+
+	walkBindings(template, func(id *ast.Identifier) bool {
+		if escaped[id.Value] {
+			return false
+		}
+		setName(id, gensym(id.Value).Value)
+		return true
+	}, func(id, binder *ast.Identifier) {
+		if binder != nil {
+			setName(id, binder.Value)
+		}
+	})
+}
+
+func setName(id *ast.Identifier, name string) {
+	id.Token.Literal = name
+	id.Value = name
+}
+
+// escapedIdentifier returns the identifier call marks with escape(name)
+func escapedIdentifier(call *ast.CallExpression) (*ast.Identifier, bool) {
+	if !isCallTo(call, "escape") || len(call.Arguments) != 1 {
+		return nil, false
+	}
+	id, ok := call.Arguments[0].(*ast.Identifier)
+	return id, ok
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	id, ok := call.Function.(*ast.Identifier)
+	return ok && id.Value == name
+}
@@ -1,14 +1,27 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/parser"
+	"strings"
 )
 
+// DefineMacros defines the macros the top level of program defines in env
+// and removes their definitions. Expand defines those of nested blocks.
 func DefineMacros(program *ast.Program, env *object.Environment) {
+	program.Statements = defineMacros(program.Statements, env)
+}
+
+// defineMacros defines the macros among statements in env and returns the
+// other statements
+func defineMacros(statements []ast.Statement, env *object.Environment) []ast.Statement {
 	definitions := []int{}
 
-	for i, s := range program.Statements {
+	for i, s := range statements {
 		if isMarcoDefinition(s) {
 			addMacro(s, env)
 			definitions = append(definitions, i)
@@ -17,11 +30,12 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 
 	for i := len(definitions) - 1; i >= 0; i = i - 1 {
 		definitionIndex := definitions[i]
-		program.Statements = append(
-			program.Statements[:definitionIndex],
-			program.Statements[definitionIndex+1:]...,
+		statements = append(
+			statements[:definitionIndex],
+			statements[definitionIndex+1:]...,
 		)
 	}
+	return statements
 }
 
 func isMarcoDefinition(node ast.Statement) bool {
@@ -50,29 +64,189 @@ func addMacro(s ast.Statement, env *object.Environment) {
 	env.Set(letS.Name.Value, macro)
 }
 
+// ExpandMacros expands the macro calls in program, leaving those that fail
+// in place, Expand reports them
 func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(node ast.Node) ast.Node {
+	expanded, _ := Expand(program, env)
+	return expanded
+}
+
+// maxExpansionDepth bounds how deeply macro calls can expand into further
+// macro calls
+const maxExpansionDepth = 100
+
+// Expand expands the macro calls in program and reports each call it could
+// not expand, left in place, as an error diagnostic at the call. What a
+// macro call expands into is expanded in turn until no macro calls are
+// left. A macro defined in a block is only known within that block.
+func Expand(program ast.Node, env *object.Environment) (ast.Node, []parser.Diagnostic) {
+	x := &expander{failed: map[*ast.CallExpression]bool{}}
+	return x.expand(program, env), x.diagnostics
+}
+
+// ExpandContext expands program like Expand, but a macro body fails with a
+// LimitError or a CancelledError once the bodies evaluated exceed limits or
+// ctx is done
+func ExpandContext(ctx context.Context, program ast.Node, env *object.Environment, limits object.Limits) (ast.Node, []parser.Diagnostic) {
+	prev := env.Budget()
+	env.SetBudget(object.NewBudget(ctx, limits))
+	defer env.SetBudget(prev)
+
+	return Expand(program, env)
+}
+
+// expander expands the macro calls of a program
+type expander struct {
+	diagnostics []parser.Diagnostic
+	// expanding lists the macro calls being expanded, each one found in
+	// the expansion of the one before it
+	expanding []*ast.CallExpression
+	// failed holds the calls reported, which an expansion can hold again
+	failed map[*ast.CallExpression]bool
+}
+
+func (x *expander) expand(node ast.Node, env *object.Environment) ast.Node {
+	scopes := defineScopedMacros(node, env)
+
+	return ast.Modify(node, func(node ast.Node) ast.Node {
 		callExpression, ok := node.(*ast.CallExpression)
 		if !ok {
 			return node
 		}
-		macro, ok := isMacroCall(callExpression, env)
+		scope, ok := scopes[callExpression]
 		if !ok {
+			scope = env
+		}
+		macro, ok := isMacroCall(callExpression, scope)
+		if !ok || x.failed[callExpression] {
 			return node
 		}
 
-		args := quoteArgs(callExpression)
-		evalEnv := extendMacroEnv(macro, args)
+		if err := x.checkRecursion(callExpression); err != nil {
+			x.report(callExpression, err)
+			return node
+		}
+		expansion, err := expandMacroCall(callExpression, macro)
+		if err != nil {
+			x.report(callExpression, err)
+			return node
+		}
 
-		ed := Eval(macro.Body, evalEnv)
+		x.expanding = append(x.expanding, callExpression)
+		expansion = x.expand(expansion, scope)
+		x.expanding = x.expanding[:len(x.expanding)-1]
+		return expansion
+	})
+}
 
-		quote, ok := ed.(*object.Quote)
-		if !ok {
-			panic("we only support returning AST-nodes from macros")
+// checkRecursion fails a macro call that repeats one it is found in the
+// expansion of, which would expand forever, or that is nested too deeply
+func (x *expander) checkRecursion(call *ast.CallExpression) error {
+	for i, outer := range x.expanding {
+		if outer.String() != call.String() {
+			continue
+		}
+		cycle := []string{}
+		for _, c := range x.expanding[i:] {
+			cycle = append(cycle, c.String())
+		}
+		cycle = append(cycle, call.String())
+		return fmt.Errorf("expansion cycle: %s", strings.Join(cycle, " -> "))
+	}
+	if len(x.expanding) >= maxExpansionDepth {
+		return fmt.Errorf("expansion nested deeper than %d macro calls", maxExpansionDepth)
+	}
+	return nil
+}
+
+// report adds the diagnostic of a macro call that failed to expand. A call
+// found in the expansion of another is reported at the call in the source
+// the expansion started from.
+func (x *expander) report(call *ast.CallExpression, err error) {
+	x.failed[call] = true
+	site := call
+	if len(x.expanding) != 0 {
+		site = x.expanding[0]
+	}
+	x.diagnostics = append(x.diagnostics, parser.Diagnostic{
+		Severity: parser.SeverityError,
+		Pos:      site.Pos(),
+		End:      site.End(),
+		Message:  fmt.Sprintf("macro %s: %s", call.Function, err),
+	})
+}
+
+// defineScopedMacros defines the macros of the blocks under node, and those
+// at its top level if it is a program, and removes their definitions. The
+// macros of a block are defined in a scope of their own, enclosed by the
+// scope of the block holding it. It returns the scope of each call.
+func defineScopedMacros(node ast.Node, env *object.Environment) map[*ast.CallExpression]*object.Environment {
+	scopes := map[*ast.CallExpression]*object.Environment{}
+	stack := []*object.Environment{env}
+
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return false
 		}
 
-		return quote.Node
+		scope := stack[len(stack)-1]
+		switch node := node.(type) {
+		case *ast.Program:
+			DefineMacros(node, scope)
+		case *ast.BlockStatement:
+			if hasMacroDefinition(node.Statements) {
+				scope = object.NewEnclosedEnvironment(scope)
+				node.Statements = defineMacros(node.Statements, scope)
+			}
+		case *ast.CallExpression:
+			scopes[node] = scope
+		}
+		stack = append(stack, scope)
+		return true
 	})
+
+	return scopes
+}
+
+func hasMacroDefinition(statements []ast.Statement) bool {
+	for _, s := range statements {
+		if isMarcoDefinition(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandMacroCall evaluates the body of macro for call and returns the
+// node it quotes
+func expandMacroCall(call *ast.CallExpression, macro *object.Macro) (ast.Node, error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(call.Arguments), len(macro.Parameters))
+	}
+
+	args := quoteArgs(call)
+	evalEnv := extendMacroEnv(macro, args)
+
+	// every expansion renames the names the macro binds afresh
+	body := ast.Copy(macro.Body).(*ast.BlockStatement)
+	hygienize(body)
+
+	ed := runTailCall(unwrapReturnValue(evalBlock(body, evalEnv, true)))
+
+	switch ed := ed.(type) {
+	case *object.Quote:
+		return ed.Node, nil
+	case *object.Error:
+		if ed.Pos.IsValid() {
+			return nil, fmt.Errorf("%s: %s", ed.Pos, ed.Message)
+		}
+		return nil, errors.New(ed.Message)
+	case nil:
+		return nil, errors.New("must return a quote, got nothing")
+	default:
+		return nil, fmt.Errorf("must return a quote, got %s", ed.Type())
+	}
 }
 
 func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
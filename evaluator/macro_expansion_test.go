@@ -2,6 +2,8 @@ package evaluator
 
 import (
 	"monkey/object"
+	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -50,3 +52,379 @@ func TestExpadMacros(t *testing.T) {
 		}
 	}
 }
+
+func TestHygienicMacros(t *testing.T) {
+	swap := `let swap = macro(a, b) {
+		quote(if (true) { let tmp = unquote(a); unquote(a) = unquote(b); unquote(b) = tmp; });
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// the tmp of the caller is swapped rather than the one of the macro
+		{swap + `let tmp = 1; let y = 2; swap(tmp, y); [tmp, y]`, "[2, 1]"},
+		// the tmp of the macro does not clobber the one of the caller
+		{swap + `let tmp = 0; let x = 1; let y = 2; swap(x, y); [tmp, x, y]`, "[0, 2, 1]"},
+		{
+			`let twice = macro(x) { quote(fn(n) { unquote(x) + unquote(x) }(1)) };
+			let n = 10; twice(n)`,
+			"20",
+		},
+		{
+			`let sum = macro(arr) { quote(if (true) { let total = 0; for (x in unquote(arr)) { total += x }; total }) };
+			let x = 100; let total = 5; [sum([1, 2, 3]), x, total]`,
+			"[6, 100, 5]",
+		},
+		// a free name in one quote refers to the caller's variable, even
+		// unquoted into the scope of a binding of the name in another
+		{
+			`let init = macro(v) { let double = quote(tmp * 2); quote(if (true) { let tmp = unquote(v); unquote(double) }) };
+			let tmp = 7; [init(3), tmp]`,
+			"[14, 7]",
+		},
+		// only the uses within the scope of a binding are renamed
+		{
+			`let x = 10; let m = macro() { quote(fn(x) { x * 2 }(x)) }; m()`,
+			"20",
+		},
+		{
+			`let x = 1; let m = macro() { quote([fn() { let x = 2; x }(), x, try { throw 4 } catch (x) { x["message"] }, x]) }; m()`,
+			"[2, 1, 4, 1]",
+		},
+		{
+			`let x = 1; let m = macro() { quote(if (true) { let s = 0; for (x in [3, x]) { s += x }; [s, x] }) }; m()`,
+			"[4, 1]",
+		},
+		// escape binds a name for the code passed to the macro
+		{
+			`let aif = macro(cond, then) { quote(if (true) { let it = unquote(cond); if (escape(it)) { unquote(then) } }) };
+			aif(5 * 2, it + 1)`,
+			"11",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded := ExpandMacros(program, env)
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestUnhygienicIdentifier(t *testing.T) {
+	input := `let aif = macro(cond, then) { quote(if (true) { let it = unquote(cond); if (it) { unquote(then) } }) };
+	aif(5 * 2, it + 1)`
+
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded := ExpandMacros(program, env)
+
+	err, ok := Eval(expanded, object.NewEnvironment()).(*object.Error)
+	if !ok || err.Message != "identifier not found: it" {
+		t.Errorf("expected the it of the caller not to be found. got=%v", err)
+	}
+}
+
+func TestGensym(t *testing.T) {
+	input := `let names = macro() { let a = gensym(); let b = gensym("tmp"); quote([unquote(a), unquote(b)]) };
+	names()`
+
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded := ExpandMacros(program, env)
+
+	if matched, _ := regexp.MatchString(`^\[g#\d+, tmp#\d+\]$`, expanded.String()); !matched {
+		t.Fatalf("wrong expansion. got=%q", expanded.String())
+	}
+	if ExpandMacros(testParseProgram("names()"), env).String() == expanded.String() {
+		t.Errorf("gensym returned the same names twice: %q", expanded.String())
+	}
+
+	// a name from gensym bound in a template
+	bindings := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let double = macro(v) { let g = gensym("n"); quote(fn(unquote(g)) { unquote(g) * 2 }(unquote(v))) };
+			let n = 10; [double(21), double(n)]`,
+			"[42, 20]",
+		},
+		{
+			`let swap = macro(a, b) { let t = gensym("t"); quote(if (true) { let unquote(t) = unquote(a); unquote(a) = unquote(b); unquote(b) = unquote(t); }) };
+			let t = 1; let u = 2; swap(t, u); [t, u]`,
+			"[2, 1]",
+		},
+		{
+			`let sum = macro(arr) { let x = gensym("x"); let s = gensym("s");
+				quote(if (true) { let unquote(s) = 0; for (unquote(x) in unquote(arr)) { unquote(s) += unquote(x) }; unquote(s) }) };
+			let x = 100; [sum([1, 2, 3]), x]`,
+			"[6, 100]",
+		},
+		{
+			`let safe = macro(e) { let err = gensym("err"); quote(try { unquote(e) } catch (unquote(err)) { unquote(err)["message"] }) };
+			safe(1 / 0)`,
+			"division by zero",
+		},
+	}
+	for _, tt := range bindings {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded := ExpandMacros(program, env)
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval(`gensym(1)`)
+	err, ok := evaluated.(*object.Error)
+	if !ok || err.Message != "argument to `gensym` must be STRING, got INTEGER" {
+		t.Errorf("wrong error. got=%v", evaluated)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let two = macro(a, b) { quote(unquote(a) + unquote(b)) };
+			two(1);`,
+			[]string{"2:4: macro two: wrong number of arguments. got=1, want=2"},
+		},
+		{
+			`let number = macro() { 1 };
+			let none = macro() { };
+			number() + none();`,
+			[]string{
+				"3:4: macro number: must return a quote, got INTEGER",
+				"3:15: macro none: must return a quote, got nothing",
+			},
+		},
+		{
+			`let broken = macro(x) { y };
+			broken(1);`,
+			[]string{"2:4: macro broken: 1:25: identifier not found: y"},
+		},
+		{
+			`let ok = macro(x) { quote(unquote(x) * 2) };
+			ok(2);`,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, diagnostics := Expand(program, env)
+
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, d.String())
+		}
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%q", tt.input, tt.expected, messages)
+		}
+	}
+}
+
+func TestSplicingMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let flip = macro(f, a, b, c) { quote(unquote(f)(unquote_splice([c, b, a]))) };
+			flip(fn(x, y, z) { [x, y, z] }, 1, 2, 3)`,
+			"[3, 2, 1]",
+		},
+		{
+			`let thrice = macro(body) { quote(if (true) { unquote_splice([body, body, body]) }) };
+			let x = 0; thrice(x += 1); x`,
+			"3",
+		},
+		{
+			`let squares = macro() { let elements = [1]; let i = 2; while (i <= 4) { elements = push(elements, i * i); i += 1 }; quote([unquote_splice(elements)]) };
+			squares()`,
+			"[1, 4, 9, 16]",
+		},
+		// an array literal passed to a macro is spliced element by element
+		{
+			`let call = macro(f, args) { quote(unquote(f)(unquote_splice(args))) };
+			let x = 2; call(push, [[1, x], x + 1])`,
+			"[1, 2, 3]",
+		},
+		{
+			`let all = macro(body) { quote([unquote_splice(body), unquote_splice(body)]) };
+			all([1, "a"])`,
+			"[1, a, 1, a]",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, diagnostics := Expand(program, env)
+		if len(diagnostics) != 0 {
+			t.Fatalf("expansion of %q failed: %v", tt.input, diagnostics)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRecursiveExpansion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+			quadruple(3)`,
+			"12",
+		},
+		{
+			// a macro can expand into a call of itself with less to do
+			`let sum = macro(a, b, c) { quote(unquote(a) + add(unquote(b), unquote(c))) };
+			let add = macro(a, b) { quote(unquote(a) + unquote(b)) };
+			sum(1, 2, 3)`,
+			"6",
+		},
+		{
+			`let twice = macro(x) { quote(if (true) { unquote(x); unquote(x) }) };
+			let x = 0; twice(twice(x += 1)); x`,
+			"4",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, diagnostics := Expand(program, env)
+		if len(diagnostics) != 0 {
+			t.Fatalf("expansion of %q failed: %v", tt.input, diagnostics)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestScopedMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let f = fn(n) { let twice = macro(x) { quote(unquote(x) * 2) }; twice(n) };
+			f(4)`,
+			"8",
+		},
+		{
+			`let f = fn() { let twice = macro(x) { quote(unquote(x) * 2) }; 1 };
+			twice(1)`,
+			"ERROR: 2:4: identifier not found: twice",
+		},
+		{
+			// an inner macro shadows an outer one within its block only
+			`let m = macro() { quote(1) };
+			let inner = if (true) { let m = macro() { quote(2) }; m() } else { m() };
+			[inner, m()]`,
+			"[2, 1]",
+		},
+		{
+			// macros of an outer block are known in the blocks within
+			`let f = fn() { let m = macro(x) { quote([unquote(x)]) }; fn() { m(3) } };
+			f()()`,
+			"[3]",
+		},
+		{
+			// macros can define macros in the code they expand into
+			`let define = macro(x) { quote(fn() { let inc = macro(y) { quote(unquote(y) + 1) }; inc(unquote(x)) }) };
+			define(41)()`,
+			"42",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, diagnostics := Expand(program, env)
+		if len(diagnostics) != 0 {
+			t.Fatalf("expansion of %q failed: %v", tt.input, diagnostics)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRecursiveExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let loop = macro() { quote(loop()) };
+			loop();`,
+			[]string{"2:4: macro loop: expansion cycle: loop() -> loop()"},
+		},
+		{
+			`let ping = macro(x) { quote(pong(unquote(x))) };
+			let pong = macro(x) { quote(ping(unquote(x))) };
+			1 + ping(1);`,
+			[]string{"3:8: macro ping: expansion cycle: ping(1) -> pong(1) -> ping(1)"},
+		},
+		{
+			`let grow = macro(x) { quote(grow(unquote(x) + 1)) };
+			grow(0);`,
+			[]string{"2:4: macro grow: expansion nested deeper than 100 macro calls"},
+		},
+		{
+			`let bad = macro() { 1 };
+			let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+			twice(bad());`,
+			[]string{"3:10: macro bad: must return a quote, got INTEGER"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, diagnostics := Expand(program, env)
+
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, d.String())
+		}
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%q", tt.input, tt.expected, messages)
+		}
+	}
+}
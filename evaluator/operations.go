@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// The functions below expose the evaluator's operator semantics to the vm,
+// so both backends produce the same values and the same errors.
+
+// InfixOperation applies a binary operator such as "+" or "<=" to evaluated operands
+func InfixOperation(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right, nil)
+}
+
+// PrefixOperation applies "!" or "-" to an evaluated operand
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right, nil)
+}
+
+// IndexOperation evaluates left[index]
+func IndexOperation(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// IndexAssignment evaluates left[index] = value
+func IndexAssignment(left, index, value object.Object) object.Object {
+	return evalIndexAssignment(left, index, value)
+}
+
+// IsTruthy reports whether a condition holding obj is taken
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// LookupBuiltin returns the builtin function called name
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// Unquote replaces the unquote and unquote_splice calls in template, which
+// it changes, by the nodes of their values. value gives the value of the
+// argument of such a call.
+func Unquote(template ast.Node, value func(arg ast.Expression) object.Object) (ast.Node, *object.Error) {
+	return substituteUnquotes(template, value)
+}
+
+// ThrownError turns the value of a throw statement into an error
+func ThrownError(value object.Object) *object.Error {
+	return newThrownError(value)
+}
+
+// CaughtError is the value a catch block binds err to
+func CaughtError(err *object.Error) object.Object {
+	return caughtError(err)
+}
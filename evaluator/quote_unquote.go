@@ -8,38 +8,217 @@ import (
 )
 
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
+	// unquote calls are replaced in a copy, so the quoted source stays
+	// intact when it is evaluated again
+	node, err := evalUnquoteCalls(ast.Copy(node), env)
+	if err != nil {
+		return err
+	}
 	return &object.Quote{Node: node}
 }
 
-func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(quoted, func(node ast.Node) ast.Node {
-		if !isUnquoteCall(node) {
+// evalUnquoteCalls replaces the unquote and unquote_splice calls in quoted
+// by the nodes of their values. It stops at the first value that is an
+// error or cannot be turned into a node and returns that error.
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return substituteUnquotes(quoted, func(arg ast.Expression) object.Object {
+		return Eval(arg, env)
+	})
+}
+
+// substituteUnquotes replaces the unquote calls in quoted by the nodes of
+// their values, and splices the nodes of the array an unquote_splice call
+// has for its value into the arguments, elements or statements holding the
+// call. value gives the value of the argument of such a call.
+func substituteUnquotes(quoted ast.Node, value func(arg ast.Expression) object.Object) (ast.Node, *object.Error) {
+	var err *object.Error
+	// the nodes of the unquote_splice calls visited, which the node
+	// holding them, visited next, splices in
+	spliced := map[ast.Expression][]ast.Expression{}
+
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil {
 			return node
 		}
 
-		call, ok := node.(*ast.CallExpression)
-		if !ok {
-			return node
+		switch node := node.(type) {
+		case *ast.CallExpression:
+			node.Arguments = splice(node.Arguments, spliced)
+		case *ast.ArrayLiteral:
+			node.Elements = splice(node.Elements, spliced)
+		case *ast.BlockStatement:
+			node.Statements = spliceStatements(node.Statements, spliced)
+		case *ast.Identifier:
+			if node.Unquote == nil || len(node.Unquote.Arguments) != 1 {
+				return node
+			}
+			name, e := unquoteName(value(node.Unquote.Arguments[0]))
+			if e != nil {
+				err = e
+				return node
+			}
+			return name
 		}
 
-		if len(call.Arguments) != 1 {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || len(call.Arguments) != 1 {
 			return node
 		}
 
-		unquoted := Eval(call.Arguments[0], env)
-		return convertObjectToASTNode(unquoted)
+		switch {
+		case isUnquoteCall(call):
+			unquoted := value(call.Arguments[0])
+			if e, ok := unquoted.(*object.Error); ok {
+				err = e
+				return node
+			}
+			converted, e := convertObjectToASTNode(unquoted)
+			if e != nil {
+				err = e
+				return node
+			}
+			return converted
+
+		case isUnquoteSpliceCall(call):
+			nodes, e := spliceNodes(value(call.Arguments[0]))
+			if e != nil {
+				err = e
+				return node
+			}
+			spliced[call] = nodes
+		}
+		return node
 	})
+
+	if err == nil && len(spliced) != 0 {
+		err = newError(object.ValueError, "unquote_splice must be an argument, an array element or a statement")
+	}
+	return node, err
+}
+
+// unquoteName returns the identifier an unquote call standing for a bound
+// name has for its value, a quoted identifier such as gensym gives
+func unquoteName(obj object.Object) (*ast.Identifier, *object.Error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		return nil, newError(object.TypeError, "cannot bind %s, it is not an identifier", obj.Type())
+	}
+	id, ok := quote.Node.(*ast.Identifier)
+	if !ok || id.Unquote != nil {
+		return nil, newError(object.TypeError, "cannot bind %s, it is not an identifier", quote.Node)
+	}
+	return &ast.Identifier{Token: id.Token, Value: id.Value}, nil
 }
 
-func convertObjectToASTNode(obj object.Object) ast.Node {
+// spliceNodes returns the nodes of the elements of the array an
+// unquote_splice call has for its value, or of the array literal it quotes,
+// as an array passed to a macro is
+func spliceNodes(obj object.Object) ([]ast.Expression, *object.Error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+	if quote, ok := obj.(*object.Quote); ok {
+		if literal, ok := quote.Node.(*ast.ArrayLiteral); ok {
+			return append([]ast.Expression(nil), literal.Elements...), nil
+		}
+	}
+	array, ok := obj.(*object.Array)
+	if !ok {
+		return nil, newError(object.TypeError, "argument to `unquote_splice` must be ARRAY, got %s", obj.Type())
+	}
+
+	nodes := make([]ast.Expression, len(array.Elements))
+	for i, element := range array.Elements {
+		node, err := convertObjectToASTNode(element)
+		if err != nil {
+			return nil, err
+		}
+		exp, ok := node.(ast.Expression)
+		if !ok {
+			return nil, newError(object.TypeError, "cannot splice %s, it is not an expression", node)
+		}
+		nodes[i] = exp
+	}
+	return nodes, nil
+}
+
+// splice replaces the spliced unquote_splice calls among exps by their nodes
+func splice(exps []ast.Expression, spliced map[ast.Expression][]ast.Expression) []ast.Expression {
+	if len(spliced) == 0 {
+		return exps
+	}
+	out := make([]ast.Expression, 0, len(exps))
+	for _, exp := range exps {
+		if nodes, ok := spliced[exp]; ok {
+			out = append(out, nodes...)
+			delete(spliced, exp)
+		} else {
+			out = append(out, exp)
+		}
+	}
+	return out
+}
+
+// spliceStatements replaces the statements made of a spliced unquote_splice
+// call by a statement for each of its nodes
+func spliceStatements(stmts []ast.Statement, spliced map[ast.Expression][]ast.Expression) []ast.Statement {
+	if len(spliced) == 0 {
+		return stmts
+	}
+	out := make([]ast.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			out = append(out, stmt)
+			continue
+		}
+		nodes, ok := spliced[es.Expression]
+		if !ok {
+			out = append(out, stmt)
+			continue
+		}
+		for _, node := range nodes {
+			out = append(out, &ast.ExpressionStatement{Token: es.Token, Expression: node})
+		}
+		delete(spliced, es.Expression)
+	}
+	return out
+}
+
+// convertObjectToASTNode returns the node of a literal that evaluates to
+// obj. Functions become function literals, which look their free variables
+// up where the node is spliced in. Other values, such as builtins and
+// macros, have no literal and give an error, as does an array or hash
+// holding itself.
+func convertObjectToASTNode(obj object.Object) (ast.Node, *object.Error) {
+	return objectToNode(obj, map[object.Object]bool{})
+}
+
+// objectToNode converts obj inside the containers in active
+func objectToNode(obj object.Object, active map[object.Object]bool) (ast.Node, *object.Error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		if active[obj] {
+			return nil, newError(object.TypeError, "cannot unquote %s holding itself", obj.Type())
+		}
+		active[obj] = true
+		defer delete(active, obj)
+	}
+
 	switch obj := obj.(type) {
 	case *object.Integer:
 		t := token.Token{
 			Type:    token.INT,
 			Literal: fmt.Sprintf("%d", obj.Value),
 		}
-		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect()}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, nil
 
 	case *object.Boolean:
 		var t token.Token
@@ -48,13 +227,109 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 		} else {
 			t = token.Token{Type: token.FALSE, Literal: "false"}
 		}
-		return &ast.Boolean{Token: t, Value: obj.Value}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+
+	case *object.Null:
+		return &ast.Null{Token: token.Token{Type: token.NULL, Literal: "null"}}, nil
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, element := range obj.Elements {
+			node, err := objectToNode(element, active)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = node.(ast.Expression)
+		}
+		return &ast.ArrayLiteral{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "["},
+			Elements: elements,
+			Rbracket: token.Token{Type: token.RBRACKET, Literal: "]"},
+		}, nil
+
+	case *object.Hash:
+		pairs := make(map[ast.Expression]ast.Expression, len(obj.Pairs))
+		for _, pair := range obj.SortedPairs() {
+			key, err := objectToNode(pair.Key, active)
+			if err != nil {
+				return nil, err
+			}
+			value, err := objectToNode(pair.Value, active)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.(ast.Expression)] = value.(ast.Expression)
+		}
+		return &ast.HashLiteral{
+			Token:  token.Token{Type: token.LBRACE, Literal: "{"},
+			Pairs:  pairs,
+			Rbrace: token.Token{Type: token.RBRACE, Literal: "}"},
+		}, nil
+
+	case *object.Function:
+		literal := functionLiteral(obj.Parameters, obj.Body, obj.Name)
+		if err := checkCaptures(literal, obj.Env.IsLocal); err != nil {
+			return nil, err
+		}
+		return literal, nil
+
+	case *object.Closure:
+		literal := obj.Fn.Literal
+		literal = functionLiteral(literal.Parameters, literal.Body, literal.Name)
+		if err := checkCaptures(literal, obj.Scope.Declares); err != nil {
+			return nil, err
+		}
+		return literal, nil
+
 	case *object.Quote:
-		return obj.Node
+		return obj.Node, nil
 
 	default:
-		return nil
+		return nil, newError(object.TypeError, "cannot unquote %s", obj.Type())
+	}
+}
+
+// functionLiteral copies the parts of a function into a new literal, as
+// the nodes it is spliced into must not be shared with the function
+func functionLiteral(params []*ast.Identifier, body *ast.BlockStatement, name string) *ast.FunctionLiteral {
+	literal := &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: params,
+		Body:       body,
+		Name:       name,
 	}
+	return ast.Copy(literal).(*ast.FunctionLiteral)
+}
+
+// checkCaptures fails for a function that uses a variable local to where it
+// was defined, which the literal it is unquoted as cannot take along
+func checkCaptures(literal *ast.FunctionLiteral, isLocal func(name string) bool) *object.Error {
+	for _, name := range freeNames(literal) {
+		if isLocal(name) {
+			return newError(object.TypeError, "cannot unquote a function using the local variable %s", name)
+		}
+	}
+	return nil
+}
+
+// freeNames lists the names literal uses but does not bind itself, in the
+// order of their first use
+func freeNames(literal *ast.FunctionLiteral) []string {
+	var names []string
+	free := map[string]bool{}
+	walkBindings(literal, func(*ast.Identifier) bool {
+		return true
+	}, func(id, binder *ast.Identifier) {
+		if binder == nil && !free[id.Value] {
+			free[id.Value] = true
+			names = append(names, id.Value)
+		}
+	})
+	return names
 }
 
 func isUnquoteCall(node ast.Node) bool {
@@ -65,3 +340,12 @@ func isUnquoteCall(node ast.Node) bool {
 
 	return callExpression.Function.TokenLiteral() == "unquote"
 }
+
+func isUnquoteSpliceCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote_splice"
+}
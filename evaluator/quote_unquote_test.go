@@ -67,6 +67,22 @@ func TestQuoteUnquote(t *testing.T) {
 			quote(unquote(4 + 4) + unquote(exp))`,
 			`(8 + (4 + 4))`,
 		},
+		{
+			`let q = fn(n) { quote(unquote(n) * 2) };
+			q(1);
+			q(3)`,
+			`(3 * 2)`,
+		},
+		{`quote(unquote(2.5))`, `2.5`},
+		{`quote(unquote(null))`, `null`},
+		{`quote(unquote("abc"))`, `abc`},
+		{`quote(unquote([1, "a", [true]]))`, `[1, a, [true]]`},
+		{`quote(unquote({"a": [null]}))`, `{a:[null]}`},
+		{
+			`let add = fn(a, b) { a + b };
+			quote(unquote(add)(1, 2))`,
+			`fn(a,b) (a + b)(1,2)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -84,3 +100,105 @@ func TestQuoteUnquote(t *testing.T) {
 		}
 	}
 }
+
+// values unquoted in a macro evaluate to themselves where the macro is called
+func TestUnquoteRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro() { let v = "a b"; quote(unquote(v)) }; m()`, `a b`},
+		{`let m = macro() { quote(unquote([1, 2.5, null, {"k": [true]}])) }; m()`, `[1, 2.5, null, {k: [true]}]`},
+		{`let m = macro(n) { let twice = fn(x) { x * 2 }; quote(unquote(twice)(unquote(n))) }; m(21)`, `42`},
+		// a function can use builtins and the names it binds itself
+		{`let m = macro() { let f = fn(a) { let b = a; for (c in [b]) { b += c }; try { throw b } catch (e) { len([e]) + b } }; quote(unquote(f)(1)) }; m()`, `3`},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded := ExpandMacros(program, env)
+
+		ed := Eval(expanded, object.NewEnvironment())
+		if ed.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, ed.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(len))`, "cannot unquote BUILTIN"},
+		{`quote(unquote([1, len]))`, "cannot unquote BUILTIN"},
+		{`quote(1 + unquote(1 / 0))`, "division by zero"},
+		{`let a = [1]; a[0] = a; quote(unquote(a))`, "cannot unquote ARRAY holding itself"},
+		{`let h = {}; h["h"] = [h]; quote(unquote(h))`, "cannot unquote HASH holding itself"},
+		{`let f = fn() { let y = 3; fn(a) { a + y } }; quote(unquote(f()))`, "cannot unquote a function using the local variable y"},
+		{`let f = fn(y) { [fn() { fn(a) { a + y } }] }; quote(unquote(f(1)))`, "cannot unquote a function using the local variable y"},
+	}
+
+	for _, tt := range tests {
+		ed := testEval(tt.input)
+		err, ok := ed.(*object.Error)
+		if !ok {
+			t.Errorf("expected *object.Error for %q. got=%T (%+v)", tt.input, ed, ed)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong message for %q. got=%q, want=%q", tt.input, err.Message, tt.expected)
+		}
+	}
+}
+
+func TestUnquoteSplice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let args = [quote(1), quote(x + y)]; quote(f(0, unquote_splice(args), 3))`, `f(0,1,(x + y),3)`},
+		{`quote(f(unquote_splice([])))`, `f()`},
+		{`quote([unquote_splice([1, "a"]), unquote_splice([true])])`, `[1, a, true]`},
+		{`quote(if (x) { a; unquote_splice([quote(b), quote(c)]); d })`, `ifx abcd`},
+		{`quote(fn() { unquote_splice([quote(1)]) })`, `fn() 1`},
+		{`quote(f(unquote_splice(quote([a, b + 1]))))`, `f(a,(b + 1))`},
+	}
+
+	for _, tt := range tests {
+		ed := testEval(tt.input)
+		quote, ok := ed.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote for %q. got=%T (%+v)", tt.input, ed, ed)
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestUnquoteSpliceErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(f(unquote_splice(1)))`, "argument to `unquote_splice` must be ARRAY, got INTEGER"},
+		{`quote(f(unquote_splice(quote(a))))`, "argument to `unquote_splice` must be ARRAY, got QUOTE"},
+		{`quote(f(unquote_splice([len])))`, "cannot unquote BUILTIN"},
+		{`quote(1 + unquote_splice([1]))`, "unquote_splice must be an argument, an array element or a statement"},
+	}
+
+	for _, tt := range tests {
+		ed := testEval(tt.input)
+		err, ok := ed.(*object.Error)
+		if !ok {
+			t.Errorf("expected *object.Error for %q. got=%T (%+v)", tt.input, ed, ed)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong message for %q. got=%q, want=%q", tt.input, err.Message, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package monkey embeds the Monkey interpreter in Go programs.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+)
+
+// Interpreter runs Monkey programs one after another, sharing their
+// globals, macros and the Go functions registered with it. It is not safe
+// for concurrent use.
+type Interpreter struct {
+	// Limits bounds every Run and Call, the zero value does not limit them
+	Limits object.Limits
+
+	env      *object.Environment
+	macroEnv *object.Environment
+}
+
+func New() *Interpreter {
+	return &Interpreter{
+		env:      object.NewEnvironment(),
+		macroEnv: object.NewEnvironment(),
+	}
+}
+
+// Run evaluates src and returns what it evaluates to, nil if that is
+// nothing. It fails with a *SyntaxError if src does not parse or one of
+// its macro calls does not expand, and with an *Error if evaluating it
+// raised one.
+func (i *Interpreter) Run(src string) (object.Object, error) {
+	return i.RunContext(context.Background(), src)
+}
+
+// RunContext runs src like Run, aborting once ctx is done
+func (i *Interpreter) RunContext(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := newSyntaxError(p.Diagnostics()); err != nil {
+		return nil, err
+	}
+
+	evaluator.DefineMacros(program, i.macroEnv)
+	expanded, diagnostics := evaluator.ExpandContext(ctx, program, i.macroEnv, i.Limits)
+	if err := newSyntaxError(diagnostics); err != nil {
+		return nil, err
+	}
+
+	return result(evaluator.EvalContext(ctx, expanded, i.env, i.Limits))
+}
+
+// Call calls the global function name with args converted by ToObject
+func (i *Interpreter) Call(name string, args ...interface{}) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls name like Call, aborting once ctx is done
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (object.Object, error) {
+	fn, ok := i.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined function %s", name)
+	}
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return nil, fmt.Errorf("%s is not a function: %s", name, fn.Type())
+	}
+
+	objects := make([]object.Object, len(args))
+	for j, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d to %s: %w", j+1, name, err)
+		}
+		objects[j] = obj
+	}
+
+	// a registered Go function calling Call keeps the budget of its caller
+	prev := i.env.Budget()
+	i.env.SetBudget(object.NewBudget(ctx, i.Limits))
+	defer i.env.SetBudget(prev)
+
+	return result(evaluator.Apply(fn, objects, i.env))
+}
+
+// Get returns the global variable name
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.env.Get(name)
+}
+
+// Set defines the global variable name, converting value by ToObject. A Go
+// function becomes a Monkey function as by RegisterFunc.
+func (i *Interpreter) Set(name string, value interface{}) error {
+	obj, err := toObject(name, value)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, obj)
+	return nil
+}
+
+// SetIO makes scripts read their input from in and write their output and
+// errors to out and errOut instead of the process's streams
+func (i *Interpreter) SetIO(in io.Reader, out, errOut io.Writer) {
+	i.env.SetIO(object.NewIO(in, out, errOut))
+}
+
+// RegisterFunc makes the Go function fn callable by scripts as name. The
+// arguments of a call are converted to the parameter types of fn, see
+// ToObject for the conversions. fn returns at most one value, optionally
+// followed by an error, which the call raises. A panic of fn is raised as
+// an error too.
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := wrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, builtin)
+	return nil
+}
+
+// Error is a runtime error raised by a Monkey program
+type Error struct {
+	Object *object.Error
+}
+
+func (e *Error) Error() string {
+	if e.Object.Pos.IsValid() {
+		return e.Object.Pos.String() + ": " + e.Object.Message
+	}
+	return e.Object.Message
+}
+
+// SyntaxError lists the errors found parsing a program or expanding its
+// macros
+type SyntaxError struct {
+	Diagnostics []parser.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// newSyntaxError reports diagnostics, nil if there are none
+func newSyntaxError(diagnostics []parser.Diagnostic) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	return &SyntaxError{Diagnostics: diagnostics}
+}
+
+func result(obj object.Object) (object.Object, error) {
+	if err, ok := obj.(*object.Error); ok {
+		return nil, &Error{Object: err}
+	}
+	return obj, nil
+}
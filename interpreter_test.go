@@ -0,0 +1,425 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterpreterRun(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 5; x * 2", int64(10)},
+		{"x + 1", int64(6)},
+		{`"a" + "b"`, "ab"},
+		{"[1, 2.5, true]", []interface{}{int64(1), 2.5, true}},
+		{`{"a": 1}`, map[interface{}]interface{}{"a": int64(1)}},
+		{"let f = fn(a) { a + x }; f(1)", int64(6)},
+		{"if (false) { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		obj, err := interp.Run(tt.input)
+		if err != nil {
+			t.Errorf("Run(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if got := ToGo(obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Run(%q) = %#v, want %#v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestInterpreterRunErrors(t *testing.T) {
+	interp := New()
+
+	_, err := interp.Run("let = 1;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *SyntaxError, got %T (%v)", err, err)
+	}
+	if len(syntaxErr.Diagnostics) == 0 {
+		t.Errorf("syntax error has no diagnostics")
+	}
+
+	_, err = interp.Run("let m = macro(x) { x }; m()")
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *SyntaxError, got %T (%v)", err, err)
+	}
+	if want := "1:25: macro m: wrong number of arguments. got=0, want=1"; err.Error() != want {
+		t.Errorf("wrong message. got=%q, want=%q", err.Error(), want)
+	}
+
+	_, err = interp.Run("let f = fn() { 1 + true }; f()")
+	var runErr *Error
+	if !errors.As(err, &runErr) {
+		t.Fatalf("expected *Error, got %T (%v)", err, err)
+	}
+	if want := "1:16: type mismatch: INTEGER + BOOLEAN"; err.Error() != want {
+		t.Errorf("wrong message. got=%q, want=%q", err.Error(), want)
+	}
+	if runErr.Object.Kind != object.TypeError {
+		t.Errorf("wrong kind. got=%q", runErr.Object.Kind)
+	}
+	if !strings.Contains(runErr.Object.Traceback(), "in f()") {
+		t.Errorf("traceback does not name f: %q", runErr.Object.Traceback())
+	}
+}
+
+func TestInterpreterCall(t *testing.T) {
+	interp := New()
+	if _, err := interp.Run("let add = fn(a, b) { a + b }; let n = 1;"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected interface{}
+		err      string
+	}{
+		{"add", []interface{}{1, 2}, int64(3), ""},
+		{"add", []interface{}{"a", "b"}, "ab", ""},
+		{"add", []interface{}{[]int{1}, 2}, nil, "1:22: type mismatch: ARRAY + INTEGER"},
+		{"add", []interface{}{1}, nil, "wrong number of arguments. got=1, want=2"},
+		{"len", []interface{}{"abc"}, nil, "undefined function len"},
+		{"n", nil, nil, "n is not a function: INTEGER"},
+		{"missing", nil, nil, "undefined function missing"},
+		{"add", []interface{}{struct{}{}, 1}, nil, "argument 1 to add: cannot convert struct {} to a Monkey object"},
+	}
+
+	for _, tt := range tests {
+		obj, err := interp.Call(tt.name, tt.args...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Call(%s, %v) wrong error. got=%v, want=%q", tt.name, tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Call(%s, %v) failed: %s", tt.name, tt.args, err)
+			continue
+		}
+		if got := ToGo(obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Call(%s, %v) = %#v, want %#v", tt.name, tt.args, got, tt.expected)
+		}
+	}
+
+	// a function ending in a loop returns null rather than nothing
+	if _, err := interp.Run("let each = fn(xs) { for (x in xs) { x } };"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := interp.Call("each", []int{1})
+	if err != nil || obj == nil || obj.Type() != object.NULL_OBJ {
+		t.Errorf("Call(each) = %v, %v, want null", obj, err)
+	}
+}
+
+func TestInterpreterSetGet(t *testing.T) {
+	interp := New()
+
+	if err := interp.Set("config", map[string]interface{}{"depth": 3, "names": []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.Set("double", func(n int) int { return 2 * n }); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.Set("bad", make(chan int)); err == nil {
+		t.Errorf("expected an error setting a channel")
+	}
+
+	if _, err := interp.Run(`let result = double(config["depth"]) + len(config["names"]);`); err != nil {
+		t.Fatal(err)
+	}
+	obj, ok := interp.Get("result")
+	if !ok {
+		t.Fatalf("result is not defined")
+	}
+	if got := ToGo(obj); got != int64(8) {
+		t.Errorf("result = %#v, want 8", got)
+	}
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("missing is defined")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := New()
+
+	register := func(name string, fn interface{}) {
+		t.Helper()
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s) failed: %s", name, err)
+		}
+	}
+	var logged []string
+	register("log", func(s string) { logged = append(logged, s) })
+	register("sum", func(ns ...float64) float64 {
+		total := 0.0
+		for _, n := range ns {
+			total += n
+		}
+		return total
+	})
+	register("join", func(parts []string, sep string) string { return strings.Join(parts, sep) })
+	register("keys", func(m map[string]int) int { return len(m) })
+	register("byte", func(n uint8) uint8 { return n })
+	register("div", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	})
+	register("describe", func(v interface{}) string { return fmt.Sprintf("%T", v) })
+	register("apply", func(f object.Object) string { return string(f.Type()) })
+	register("cyclic", func() map[string]interface{} {
+		m := map[string]interface{}{}
+		m["self"] = m
+		return m
+	})
+	register("panics", func(n int) int { return []int{}[n] })
+	register("nested", func() error {
+		_, err := interp.Run("1 + true")
+		return err
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`log("hi")`, nil},
+		{"sum()", 0.0},
+		{"sum(1, 2.5)", 3.5},
+		{`join(["a", "b"], "-")`, "a-b"},
+		{`keys({"a": 1, "b": 2})`, int64(2)},
+		{"byte(255)", int64(255)},
+		{"byte(256)", "TypeError: argument 1 to `byte`: 256 overflows uint8"},
+		{"byte(-1)", "TypeError: argument 1 to `byte`: -1 overflows uint8"},
+		{"div(7, 2)", int64(3)},
+		{"div(1, 0)", "Error: division by zero"},
+		{`try { div(1, 0) } catch (e) { e["message"] }`, "division by zero"},
+		{`describe([1, "a"])`, "[]interface {}"},
+		{"describe(1.5)", "float64"},
+		{"apply(fn() {})", "FUNCTION"},
+		{`join(1, "")`, "TypeError: argument 1 to `join`: cannot use INTEGER as []string"},
+		{`join([1], "")`, "TypeError: argument 1 to `join`: element 0: cannot use INTEGER as string"},
+		{"div(1)", "ArgumentError: wrong number of arguments to `div`. got=1, want=2"},
+		{"nested()", "TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{"panics(1)", "Error: error calling `panics`: runtime error: index out of range [1] with length 0"},
+		{`try { panics(1) } catch (e) { "caught" }`, "caught"},
+		{"cyclic()", "TypeError: result of `cyclic`: cannot convert map[string]interface {} holding itself"},
+	}
+
+	for _, tt := range tests {
+		obj, err := interp.Run(tt.input)
+		var runErr *Error
+		if errors.As(err, &runErr) {
+			got := runErr.Object.KindName() + ": " + runErr.Object.Message
+			if got != tt.expected {
+				t.Errorf("Run(%q) failed: %s, want %#v", tt.input, got, tt.expected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Run(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if got := ToGo(obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Run(%q) = %#v, want %#v", tt.input, got, tt.expected)
+		}
+	}
+
+	if !reflect.DeepEqual(logged, []string{"hi"}) {
+		t.Errorf("log was called with %q", logged)
+	}
+}
+
+func TestRegisterFuncErrors(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		expected string
+	}{
+		{42, "f: not a function: int"},
+		{(func())(nil), "f: not a function: func()"},
+		{func() (int, int) { return 0, 0 }, "f: function returns 2 values, want at most one and an error"},
+	}
+
+	for _, tt := range tests {
+		err := New().RegisterFunc("f", tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. got=%v, want=%q", err, tt.expected)
+		}
+	}
+}
+
+func TestInterpreterLimits(t *testing.T) {
+	interp := New()
+	interp.Limits = object.Limits{MaxSteps: 1000}
+
+	if _, err := interp.Run("let loop = fn() { loop() };"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := interp.Call("loop")
+	var runErr *Error
+	if !errors.As(err, &runErr) || runErr.Object.Kind != object.LimitError {
+		t.Fatalf("expected a LimitError, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	interp.Limits = object.Limits{}
+	_, err = interp.RunContext(ctx, "loop()")
+	if !errors.As(err, &runErr) || runErr.Object.Kind != object.CancelledError {
+		t.Fatalf("expected a CancelledError, got %v", err)
+	}
+}
+
+func TestInterpreterMacroLimits(t *testing.T) {
+	interp := New()
+	interp.Limits = object.Limits{MaxSteps: 10000}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := interp.RunContext(ctx, "let m = macro() { while (true) { } }; m()")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || !strings.Contains(err.Error(), "macro m: 1:32: step limit exceeded: 10000") {
+		t.Fatalf("expected the macro to exceed the step limit, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	interp.Limits = object.Limits{}
+	_, err = interp.RunContext(ctx, "m()")
+	if err == nil || !strings.Contains(err.Error(), "macro m: 1:19: evaluation cancelled") {
+		t.Fatalf("expected the macro to be cancelled, got %v", err)
+	}
+}
+
+func TestInterpreterNestedCall(t *testing.T) {
+	interp := New()
+	interp.Limits = object.Limits{MaxSteps: 1000}
+
+	if _, err := interp.Run("let one = fn() { 1 };"); err != nil {
+		t.Fatal(err)
+	}
+	// a Go function calling back into the interpreter leaves the budget of
+	// the Run calling it in place
+	err := interp.RegisterFunc("callOne", func() (int, error) {
+		result, err := interp.Call("one")
+		if err != nil {
+			return 0, err
+		}
+		return int(result.(*object.Integer).Value), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = interp.Run("callOne(); let n = 0; while (n < 1000) { n += 1 }")
+	var runErr *Error
+	if !errors.As(err, &runErr) || runErr.Object.Kind != object.LimitError {
+		t.Fatalf("expected a LimitError, got %v", err)
+	}
+}
+
+func TestToGoSelfReference(t *testing.T) {
+	array := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+
+	got, ok := ToGo(array).([]interface{})
+	if !ok || len(got) != 2 || got[0] != int64(1) {
+		t.Fatalf("wrong conversion. got=%#v", ToGo(array))
+	}
+	// the array met again inside itself is left as it is
+	if got[1] != object.Object(array) {
+		t.Errorf("wrong inner element. got=%T", got[1])
+	}
+}
+
+func TestToObject(t *testing.T) {
+	type point struct{ X int }
+	n := 7
+
+	tests := []struct {
+		input    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{int8(-3), int64(-3)},
+		{uint32(3), int64(3)},
+		{float32(0.5), 0.5},
+		{"s", "s"},
+		{&n, int64(7)},
+		{[2]bool{true, false}, []interface{}{true, false}},
+		{[]interface{}{nil, 1}, []interface{}{nil, int64(1)}},
+		{map[int]string{1: "a"}, map[interface{}]interface{}{int64(1): "a"}},
+		{&object.Integer{Value: 1}, int64(1)},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if got := ToGo(obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToObject(%#v) = %#v, want %#v", tt.input, got, tt.expected)
+		}
+	}
+
+	self := map[string]interface{}{}
+	self["self"] = self
+	list := []interface{}{1, nil}
+	list[1] = list
+
+	errorTests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{self, "cannot convert map[string]interface {} holding itself"},
+		{[]interface{}{list}, "cannot convert []interface {} holding itself"},
+		{uint64(1 << 63), "9223372036854775808 overflows INTEGER"},
+		{point{1}, "cannot convert monkey.point to a Monkey object"},
+		{map[[1]int]int{{1}: 1}, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := ToObject(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestInterpreterSetIO(t *testing.T) {
+	interp := New()
+	var stdout, stderr strings.Builder
+	interp.SetIO(strings.NewReader("a\nb\n"), &stdout, &stderr)
+
+	if _, err := interp.Run(`let echo = fn() { print(readline()); eprint("done") };`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interp.Call("echo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interp.Run("echo()"); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "a\nb\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "done\ndone\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
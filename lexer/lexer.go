@@ -2,37 +2,108 @@ package lexer
 
 import (
 	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
+	file         string // file name reported in positions, may be empty
 	input        string
-	position     int  // pos of present input literal
-	readPosition int  // the coming pos to read
-	ch           byte // the character now on check
+	position     int  // byte offset of present input literal
+	readPosition int  // the coming byte offset to read
+	ch           rune // the character now on check
+	line         int  // line of the present input literal
+	column       int  // column of the present input literal, counted in runes
+
+	comments []token.Comment // comments skipped so far, in source order
+	errors   []Error         // problems found so far, in source order
+}
+
+// Error is a problem found while scanning, such as an unterminated string
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
 }
 
 // New returns a new lexer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile returns a new lexer whose token positions carry the file name
+func NewFile(file, input string) *Lexer {
+	l := &Lexer{file: file, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
-// readChar reads one char and update the pointer: apply to ASCII only
+// readChar decodes one UTF-8 char and update the pointer; ch is 0 at EOF
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.readPosition > len(l.input) {
+		// already at EOF
+		return
 	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	l.position = l.readPosition
-	l.readPosition++
+
+	if l.readPosition == len(l.input) {
+		l.ch = 0
+		l.readPosition++
+		return
+	}
+	r, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = r
+	l.readPosition += width
+}
+
+// pos returns the position of the present input literal
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		File:   l.file,
+		Offset: l.position,
+		Line:   l.line,
+		Column: l.column,
+	}
+}
+
+// Comments returns every comment skipped so far, so tools can reattach them
+// to the nodes that follow them by position
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
 }
 
+// Errors returns every scanning error found so far
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+func (l *Lexer) addError(pos token.Position, msg string) {
+	l.errors = append(l.errors, Error{Pos: pos, Msg: msg})
+}
+
+// NextToken returns the next token with its start and end positions set
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	l.skipTrivia()
+
+	pos := l.pos()
+	tok := l.readToken()
+	tok.Pos = pos
+	tok.End = l.pos()
+
+	return tok
+}
 
-	l.skipWhitespace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -53,9 +124,17 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -65,9 +144,35 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.PERCENT_ASSIGN)
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case '!':
@@ -80,12 +185,25 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharToken(token.POWER)
+		} else if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
+	case '`':
+		tok.Type = token.STRING
+		tok.Literal = l.readRawString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -95,8 +213,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookUpIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -108,10 +225,17 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// readTwoCharToken consumes the char now on check and the next one as one token
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
@@ -120,8 +244,9 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter accepts any Unicode letter, so identifiers like café are valid
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -130,33 +255,244 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// skipTrivia skips whitespace and comments, keeping the comments
+func (l *Lexer) skipTrivia() {
+	for {
+		l.skipWhitespace()
+
+		switch {
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readLineComment()
+		case l.position == 0 && l.ch == '#' && l.peekChar() == '!':
+			// a #! line starting the input, as in an executable script
+			l.readLineComment()
+		case l.ch == '/' && l.peekChar() == '*':
+			l.readBlockComment()
+		default:
+			return
+		}
+	}
+}
+
+// readLineComment reads a // comment or a #! line up to, not including,
+// the line break
+func (l *Lexer) readLineComment() {
+	pos := l.pos()
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	l.addComment(pos)
+}
+
+// readBlockComment reads a /* */ comment; nested /* */ pairs must balance
+func (l *Lexer) readBlockComment() {
+	pos := l.pos()
+	depth := 0
+	for {
+		if l.ch == 0 {
+			l.addError(pos, "unterminated block comment")
+			break
+		}
+		if l.ch == '/' && l.peekChar() == '*' {
+			depth++
+			l.readChar()
+		} else if l.ch == '*' && l.peekChar() == '/' {
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				break
+			}
+		}
+		l.readChar()
+	}
+	l.addComment(pos)
+}
+
+func (l *Lexer) addComment(pos token.Position) {
+	end := l.pos()
+	l.comments = append(l.comments, token.Comment{
+		Text: l.input[pos.Offset:end.Offset],
+		Pos:  pos,
+		End:  end,
+	})
+}
+
+// readNumber reads an integer such as 1_000 or 0xff, or a float such as 3.14 or 1e-9
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	var tokenType token.TokenType = token.INT
 	position := l.position
-	for isDigit(l.ch) {
+
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		// 0x, 0o or 0b: the parser validates the digits against the base
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		return tokenType, l.input[position:l.position]
+	}
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if (l.ch == 'e' || l.ch == 'E') && l.exponentAhead() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+
+	return tokenType, l.input[position:l.position]
+}
+
+// readDigits reads decimal digits, allowing _ as a separator
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// exponentAhead reports whether the `e` now on check starts an exponent: e5, e+5, e-5
+func (l *Lexer) exponentAhead() bool {
+	next := l.readPosition
+	if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+		next++
+	}
+	return next < len(l.input) && '0' <= l.input[next] && l.input[next] <= '9'
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
 }
 
+// readString reads a "..." literal and decodes its escape sequences
 func (l *Lexer) readString() string {
-	postion := l.position + 1
+	start := l.pos()
+	var out strings.Builder
+
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		switch l.ch {
+		case '"':
+			return out.String()
+		case 0:
+			l.addError(start, "unterminated string literal")
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// readEscape decodes the escape sequence whose backslash is the present char
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.pos()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case 'r':
+		out.WriteRune('\r')
+	case '"':
+		out.WriteRune('"')
+	case '\\':
+		out.WriteRune('\\')
+	case 'u':
+		l.readUnicodeEscape(pos, out)
+	case 0:
+		// leave EOF to readString, which reports the unterminated literal
+	default:
+		l.addError(pos, "unknown escape sequence: \\"+string(l.ch))
+		out.WriteRune('\\')
+		out.WriteRune(l.ch)
+	}
+}
+
+// readUnicodeEscape decodes \u{X...X} holding 1 to 6 hex digits
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	if l.peekChar() != '{' {
+		l.addError(pos, "invalid unicode escape: expected \\u{...}")
+		return
+	}
+	l.readChar()
+
+	var value rune
+	digits := 0
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		value = value*16 + hexValue(l.ch)
+		digits++
+		if digits > 6 {
 			break
 		}
 	}
-	return l.input[postion:l.position]
+
+	if l.peekChar() != '}' || digits == 0 || digits > 6 || !utf8.ValidRune(value) {
+		l.addError(pos, "invalid unicode escape: expected 1 to 6 hex digits of a valid code point")
+		return
+	}
+	l.readChar()
+	out.WriteRune(value)
+}
+
+// readRawString reads a `...` literal as is: no escapes, may span lines
+func (l *Lexer) readRawString() string {
+	start := l.pos()
+	position := l.position + 1
+
+	for {
+		l.readChar()
+		if l.ch == '`' {
+			break
+		}
+		if l.ch == 0 {
+			l.addError(start, "unterminated raw string literal")
+			break
+		}
+	}
+	return l.input[position:l.position]
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
 }
@@ -84,7 +84,7 @@ func TestNewNextToken(t *testing.T) {
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if ( 5 < 10 ) {
@@ -195,3 +195,313 @@ func TestNewNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + 10;"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+		expectedEnd     token.Position
+	}{
+		{"let", token.Position{File: "a.mk", Offset: 0, Line: 1, Column: 1}, token.Position{File: "a.mk", Offset: 3, Line: 1, Column: 4}},
+		{"x", token.Position{File: "a.mk", Offset: 4, Line: 1, Column: 5}, token.Position{File: "a.mk", Offset: 5, Line: 1, Column: 6}},
+		{"=", token.Position{File: "a.mk", Offset: 6, Line: 1, Column: 7}, token.Position{File: "a.mk", Offset: 7, Line: 1, Column: 8}},
+		{"5", token.Position{File: "a.mk", Offset: 8, Line: 1, Column: 9}, token.Position{File: "a.mk", Offset: 9, Line: 1, Column: 10}},
+		{";", token.Position{File: "a.mk", Offset: 9, Line: 1, Column: 10}, token.Position{File: "a.mk", Offset: 10, Line: 1, Column: 11}},
+		{"x", token.Position{File: "a.mk", Offset: 13, Line: 2, Column: 3}, token.Position{File: "a.mk", Offset: 14, Line: 2, Column: 4}},
+		{"+", token.Position{File: "a.mk", Offset: 15, Line: 2, Column: 5}, token.Position{File: "a.mk", Offset: 16, Line: 2, Column: 6}},
+		{"10", token.Position{File: "a.mk", Offset: 17, Line: 2, Column: 7}, token.Position{File: "a.mk", Offset: 19, Line: 2, Column: 9}},
+		{";", token.Position{File: "a.mk", Offset: 19, Line: 2, Column: 9}, token.Position{File: "a.mk", Offset: 20, Line: 2, Column: 10}},
+		{"", token.Position{File: "a.mk", Offset: 20, Line: 2, Column: 10}, token.Position{File: "a.mk", Offset: 20, Line: 2, Column: 10}},
+	}
+
+	l := NewFile("a.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End != tt.expectedEnd {
+			t.Fatalf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := "let café = \"🐒 ünïcode\";\nπ + café"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.LET, "let", "1:1"},
+		{token.IDENT, "café", "1:5"},
+		{token.ASSIGN, "=", "1:10"},
+		{token.STRING, "🐒 ünïcode", "1:12"},
+		{token.SEMICOLON, ";", "1:23"},
+		{token.IDENT, "π", "2:1"},
+		{token.PLUS, "+", "2:3"},
+		{token.IDENT, "café", "2:5"},
+		{token.EOF, "", "2:9"},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%s, got=%s",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing
+/* block /* nested */ still comment */ x / 2;
+/* unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expectedComments := []struct {
+		text string
+		pos  string
+	}{
+		{"// leading comment", "1:1"},
+		{"// trailing", "2:12"},
+		{"/* block /* nested */ still comment */", "3:1"},
+		{"/* unterminated", "4:1"},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, c := range expectedComments {
+		if comments[i].Text != c.text {
+			t.Errorf("comments[%d] - text wrong. want=%q, got=%q", i, c.text, comments[i].Text)
+		}
+		if comments[i].Pos.String() != c.pos {
+			t.Errorf("comments[%d] - pos wrong. want=%s, got=%s", i, c.pos, comments[i].Pos)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	l := New("#!/usr/bin/env monkey run\nx # y")
+
+	expected := []token.TokenType{token.IDENT, token.ILLEGAL, token.IDENT, token.EOF}
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tokenType, tok.Type)
+		}
+		if i == 0 && tok.Pos.String() != "2:1" {
+			t.Errorf("wrong position of the first token. got=%s", tok.Pos)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != 1 || comments[0].Text != "#!/usr/bin/env monkey run" {
+		t.Errorf("wrong comments. got=%+v", comments)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"tab\there"`, "tab\there"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{48}\u{1F412}"`, "H🐒"},
+		{"`raw \\n\nline`", "raw \\n\nline"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tokenliteral wrong. expected=%q, got=%q", tt.expectedLiteral, tok.Literal)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("unexpected lexer errors for %s: %v", tt.input, l.Errors())
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"unterminated`, "1:1: unterminated string literal"},
+		{"x\n`raw", "2:1: unterminated raw string literal"},
+		{`"bad \q escape"`, `1:6: unknown escape sequence: \q`},
+		{`"\u{110000}"`, "1:2: invalid unicode escape: expected 1 to 6 hex digits of a valid code point"},
+		{`"\u0041"`, `1:2: invalid unicode escape: expected \u{...}`},
+		{"/* open", "1:1: unterminated block comment"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 error for %s. got=%v", tt.input, errors)
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "3.14 42 1e-9 2.5E+3 7.method 1e"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.INT, "42"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "method"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestExtendedOperators(t *testing.T) {
+	input := "<= >= && || % ** * & |"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.ASTERISK, "*"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAssignOperators(t *testing.T) {
+	input := "x += 1; x -= 1; x *= 2; x /= 2; x %= 2;"
+
+	expectedTypes := []token.TokenType{
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.PERCENT_ASSIGN, token.INT, token.SEMICOLON,
+		token.EOF,
+	}
+
+	l := New(input)
+
+	for i, expected := range expectedTypes {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, expected, tok.Type)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits bounds the resources one evaluation may use. A zero field means
+// no limit.
+type Limits struct {
+	MaxSteps     int64 // evaluated nodes, or executed instructions in the vm
+	MaxCallDepth int   // nested calls of Monkey functions
+	// MaxAllocations bounds the elements of the arrays and hashes and the
+	// bytes of the strings that literals, operators and builtins create
+	MaxAllocations int64
+}
+
+// Budget tracks an evaluation against its context and limits
+type Budget struct {
+	ctx    context.Context
+	limits Limits
+
+	steps       int64
+	depth       int
+	allocations int64
+}
+
+// the context is polled every checkInterval steps, as ctx.Err takes a lock
+const checkInterval = 1024
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{ctx: ctx, limits: limits}
+}
+
+// Step counts one step and fails once the step limit is exceeded or the
+// context is done
+func (b *Budget) Step() *Error {
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return newAbortError(LimitError, "step limit exceeded: %d", b.limits.MaxSteps)
+	}
+	if b.steps%checkInterval == 1 {
+		return b.checkContext()
+	}
+	return nil
+}
+
+func (b *Budget) checkContext() *Error {
+	if err := b.ctx.Err(); err != nil {
+		return newAbortError(CancelledError, "evaluation cancelled: %s", err)
+	}
+	return nil
+}
+
+// EnterCall counts a call of a Monkey function, which LeaveCall ends
+func (b *Budget) EnterCall() *Error {
+	if b.limits.MaxCallDepth > 0 && b.depth >= b.limits.MaxCallDepth {
+		return newAbortError(LimitError, "call depth limit exceeded: %d", b.limits.MaxCallDepth)
+	}
+	b.depth++
+	return nil
+}
+
+func (b *Budget) LeaveCall() {
+	b.depth--
+}
+
+// Allocate charges the size of a value created by the evaluation: the
+// elements of an array or hash or the bytes of a string
+func (b *Budget) Allocate(obj Object) *Error {
+	if b.limits.MaxAllocations == 0 {
+		return nil
+	}
+
+	switch obj := obj.(type) {
+	case *String:
+		b.allocations += int64(len(obj.Value))
+	case *Array:
+		b.allocations += int64(len(obj.Elements))
+	case *Hash:
+		b.allocations += int64(len(obj.Pairs))
+	}
+	if b.allocations > b.limits.MaxAllocations {
+		return newAbortError(LimitError, "allocation limit exceeded: %d", b.limits.MaxAllocations)
+	}
+	return nil
+}
+
+func newAbortError(kind, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...), aborted: true}
+}
@@ -1,15 +1,32 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+)
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	env := &Environment{store: s, outer: nil}
+	env.root = env
+	return env
 }
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// root is the outermost environment, which holds the budget and the
+	// I/O of the evaluation running in it
+	root   *Environment
+	budget *Budget
+	io     *IO
+	depth  int // nested calls of Monkey functions
 }
 
+// MaxCallDepth bounds the nested calls of Monkey functions in either
+// engine, deeper recursion is a RecursionError rather than a crash
+const MaxCallDepth = 1 << 18
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -23,8 +40,90 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Assign updates name in the scope that declared it, reporting false when
+// no enclosing scope declares name
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.root = outer.root
 	return env
 }
+
+// Budget returns the budget of the evaluation running in the environment,
+// nil if it is not limited
+func (e *Environment) Budget() *Budget {
+	return e.root.budget
+}
+
+// SetBudget limits the evaluations in the environment and the environments
+// it encloses, nil lifts the limits
+func (e *Environment) SetBudget(b *Budget) {
+	e.root.budget = b
+}
+
+// IO returns the streams of the evaluations in the environment, StdIO
+// unless SetIO gave it others
+func (e *Environment) IO() *IO {
+	if e.root.io == nil {
+		return StdIO
+	}
+	return e.root.io
+}
+
+// SetIO makes the evaluations in the environment and the environments it
+// encloses use streams, nil restores StdIO
+func (e *Environment) SetIO(streams *IO) {
+	e.root.io = streams
+}
+
+// Names returns the names bound in the environment itself, not those of
+// the environments enclosing it, sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsLocal reports whether name is bound in the environment or one of those
+// enclosing it other than the outermost one, which holds the globals
+func (e *Environment) IsLocal(name string) bool {
+	for env := e; env != e.root; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EnterCall counts a call of a Monkey function made in the environment,
+// which LeaveCall ends, and fails once the calls nest too deeply
+func (e *Environment) EnterCall() *Error {
+	if e.root.depth >= MaxCallDepth {
+		return &Error{Kind: RecursionError, Message: fmt.Sprintf("stack overflow: call depth exceeds %d", MaxCallDepth)}
+	}
+	e.root.depth++
+	return nil
+}
+
+// CallDepth returns the number of calls entered and not left
+func (e *Environment) CallDepth() int {
+	return e.root.depth
+}
+
+func (e *Environment) LeaveCall() {
+	e.root.depth--
+}
@@ -0,0 +1,122 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// inspector renders arrays and hashes for Inspect. A container met again
+// inside itself is rendered as [...] or {...} rather than recursing forever.
+// With a limit the rendering stops once limit bytes are written, so only a
+// little of a large value is read.
+type inspector struct {
+	out   strings.Builder
+	limit int // 0 for no limit
+	// active holds the containers being rendered
+	active map[Object]bool
+}
+
+func inspect(obj Object) string {
+	return inspectLimited(obj, 0)
+}
+
+// inspectLimited renders at most the first limit bytes of obj
+func inspectLimited(obj Object, limit int) string {
+	in := &inspector{limit: limit, active: map[Object]bool{}}
+	in.inspect(obj)
+	return in.out.String()
+}
+
+// full reports whether the limit has been reached
+func (in *inspector) full() bool {
+	return in.limit > 0 && in.out.Len() >= in.limit
+}
+
+func (in *inspector) write(s string) {
+	if in.limit > 0 && len(s) > in.limit-in.out.Len() {
+		s = s[:in.limit-in.out.Len()]
+	}
+	in.out.WriteString(s)
+}
+
+func (in *inspector) inspect(obj Object) {
+	if in.full() {
+		return
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		if in.active[obj] {
+			in.write("[...]")
+			return
+		}
+		in.active[obj] = true
+		defer delete(in.active, obj)
+
+		in.write("[")
+		for i, e := range obj.Elements {
+			if in.full() {
+				return
+			}
+			if i > 0 {
+				in.write(", ")
+			}
+			in.inspect(e)
+		}
+		in.write("]")
+
+	case *Hash:
+		if in.active[obj] {
+			in.write("{...}")
+			return
+		}
+		in.active[obj] = true
+		defer delete(in.active, obj)
+
+		pairs := obj.SortedPairs
+		// every pair takes more than a byte, so a limited rendering shows
+		// no more than limit of them
+		if in.limit > 0 && len(obj.Pairs) > in.limit {
+			pairs = func() []HashPair { return firstPairs(obj, in.limit) }
+		}
+
+		in.write("{")
+		for i, pair := range pairs() {
+			if in.full() {
+				return
+			}
+			if i > 0 {
+				in.write(", ")
+			}
+			in.inspect(pair.Key)
+			in.write(": ")
+			in.inspect(pair.Value)
+		}
+		in.write("}")
+
+	case *String:
+		in.write(obj.Value)
+
+	default:
+		in.write(obj.Inspect())
+	}
+}
+
+// firstPairs returns the first n pairs of h in the order of SortedPairs,
+// without sorting all of them
+func firstPairs(h *Hash, n int) []HashPair {
+	first := make([]HashPair, 0, n+1)
+	for _, pair := range h.Pairs {
+		if len(first) == n && !keyLess(pair.Key, first[n-1].Key) {
+			continue
+		}
+		i := sort.Search(len(first), func(i int) bool { return keyLess(pair.Key, first[i].Key) })
+		first = append(first, HashPair{})
+		copy(first[i+1:], first[i:])
+		first[i] = pair
+		if len(first) > n {
+			first = first[:n]
+		}
+	}
+	return first
+}
@@ -0,0 +1,55 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// IO holds the streams an evaluation reads and writes through the puts,
+// print, eprint and readline builtins
+type IO struct {
+	In  *bufio.Reader
+	Out io.Writer
+	Err io.Writer
+	// Args are the command line arguments of the script, which the args
+	// builtin returns
+	Args []string
+}
+
+// StdIO is the I/O of the evaluations that are not given their own
+var StdIO = NewIO(os.Stdin, os.Stdout, os.Stderr)
+
+// NewIO reads from in and writes to out and errOut. A nil reader is empty
+// and a nil writer discards what is written to it.
+func NewIO(in io.Reader, out, errOut io.Writer) *IO {
+	if in == nil {
+		in = strings.NewReader("")
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	if errOut == nil {
+		errOut = io.Discard
+	}
+
+	reader, ok := in.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(in)
+	}
+	return &IO{In: reader, Out: out, Err: errOut}
+}
+
+// ReadLine reads the next line of the input without its line ending. It
+// returns io.EOF only once the input is exhausted, a last line without a
+// line ending is returned as any other.
+func (s *IO) ReadLine() (string, error) {
+	line, err := s.In.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, err
+}
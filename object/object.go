@@ -4,17 +4,27 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	MACRO_OBJ        = "MACRO"
@@ -23,6 +33,9 @@ const (
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
 	QUOTE_OBJ        = "QUOTE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	COMPILED_SCOPE_OBJ    = "COMPILED_SCOPE"
 )
 
 type Object interface {
@@ -37,6 +50,20 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep a float looking like a float: 3.0 instead of 3
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -56,25 +83,202 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break unwinds the blocks of a loop body like ReturnValue unwinds a function
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+// Continue unwinds the blocks of a loop body up to the next iteration
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// TailCall is a call in tail position that the evaluator runs after the
+// calling function returned, so tail recursion does not grow the Go stack
+type TailCall struct {
+	Fn   *Function
+	Args []Object
+	Pos  token.Position // the call site
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call" }
+
+// Kinds of the errors the interpreter raises, which scripts tell apart by
+// the type field of a caught error
+const (
+	ArgumentError   = "ArgumentError"   // a call with the wrong number of arguments
+	TypeError       = "TypeError"       // an operation on values of the wrong type
+	ValueError      = "ValueError"      // a value that cannot be converted
+	NameError       = "NameError"       // an unknown identifier
+	IndexError      = "IndexError"      // an index out of range
+	ArithmeticError = "ArithmeticError" // division by zero and integer overflow
+	RecursionError  = "RecursionError"  // too deeply nested calls
+	IOError         = "IOError"         // reading or writing the streams of the evaluation failed
+
+	// errors that abort the evaluation, a try expression does not catch
+	// them
+	LimitError     = "LimitError"     // an exceeded Limits field
+	CancelledError = "CancelledError" // the context of the evaluation is done
+)
+
 type Error struct {
 	Message string
+	// Kind classifies the error, e.g. TypeError, or names the type of an
+	// error thrown by a script. Empty for a plain error.
+	Kind string
+	Pos  token.Position // where the error was raised, if known
+	// Stack lists the Monkey function calls the error unwound, innermost
+	// first. Of a deep stack only the innermost and outermost calls are
+	// kept, see AddFrame.
+	Stack []StackFrame
+	// Omitted counts the calls left out of the middle of Stack
+	Omitted int
+	// Value is what a script threw, nil for an error the interpreter raised
+	Value Object
+	// aborted marks the errors of a Budget, which scripts cannot raise
+	aborted bool
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR" + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// KindName is the type of the error as a caught error reports it
+func (e *Error) KindName() string {
+	if e.Kind == "" {
+		return "Error"
+	}
+	return e.Kind
+}
+
+// Catchable reports whether a try expression may catch the error, which
+// it may unless the error aborts the evaluation
+func (e *Error) Catchable() bool {
+	return !e.aborted
+}
+
+// stackEnds is the number of innermost and of outermost calls a stack
+// keeps
+const stackEnds = 10
+
+// AddFrame adds the call frame was unwound from to the stack. Once the
+// stack holds stackEnds innermost and outermost calls, the oldest of the
+// outermost calls is left out.
+func (e *Error) AddFrame(frame StackFrame) {
+	if len(e.Stack) == 2*stackEnds {
+		copy(e.Stack[stackEnds:], e.Stack[stackEnds+1:])
+		e.Stack = e.Stack[:len(e.Stack)-1]
+		e.Omitted++
+	}
+	e.Stack = append(e.Stack, frame)
+}
+
+// StackTrace renders the calls of the stack, innermost first, with a line
+// for those left out
+func (e *Error) StackTrace() []string {
+	lines := make([]string, 0, len(e.Stack)+1)
+	for i, frame := range e.Stack {
+		if i == stackEnds && e.Omitted > 0 {
+			lines = append(lines, fmt.Sprintf("... %d more calls", e.Omitted))
+		}
+		lines = append(lines, frame.String())
+	}
+	return lines
+}
+
+// Traceback renders the error followed by the calls that led to it
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString(e.Inspect())
+	for i, frame := range e.Stack {
+		if i == stackEnds && e.Omitted > 0 {
+			fmt.Fprintf(&out, "\n  ... %d more calls", e.Omitted)
+		}
+		out.WriteString("\n  in ")
+		out.WriteString(frame.String())
+	}
+
+	return out.String()
+}
+
+// StackFrame is a call of a Monkey function
+type StackFrame struct {
+	Function string // empty for anonymous functions
+	Args     string // summary of the arguments
+	Pos      token.Position
+}
+
+func (sf StackFrame) String() string {
+	name := sf.Function
+	if name == "" {
+		name = "fn"
+	}
+	s := name + "(" + sf.Args + ")"
+	if sf.Pos.IsValid() {
+		s += ", called at " + sf.Pos.String()
+	}
+	return s
+}
+
+// SummarizeArgs describes call arguments for a stack frame, shortening
+// long values. Only the start of a long value is rendered, as every frame
+// an error unwinds through is summarized.
+func SummarizeArgs(args []Object) string {
+	const maxLen = 24
+	// enough bytes for maxLen runes
+	const limit = maxLen * utf8.UTFMax
+
+	summaries := make([]string, len(args))
+	for i, arg := range args {
+		var s string
+		switch arg := arg.(type) {
+		case nil:
+			s = "nil"
+		case *String:
+			value := arg.Value
+			if len(value) > limit {
+				value = value[:limit]
+			}
+			s = strconv.Quote(value)
+		case *Function, *Closure:
+			s = "fn"
+		case *Builtin:
+			s = "builtin"
+		default:
+			s = inspectLimited(arg, limit)
+		}
+		if runes := []rune(s); len(runes) > maxLen {
+			s = string(runes[:maxLen-3]) + "..."
+		}
+		summaries[i] = s
+	}
+
+	return strings.Join(summaries, ", ")
+}
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
-func (f *Function) Inspect() string {
+func (f *Function) Inspect() string  { return inspectFunction(f.Parameters, f.Body) }
+
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 
@@ -82,7 +286,7 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") \n")
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -99,6 +303,17 @@ type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// IOFn replaces Fn in the builtins doing I/O, which use the streams of
+	// the evaluation calling them
+	IOFn func(streams *IO, args ...Object) Object
+}
+
+// Call calls the builtin from an evaluation doing I/O through streams
+func (b *Builtin) Call(streams *IO, args ...Object) Object {
+	if b.IOFn != nil {
+		return b.IOFn(streams, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -109,20 +324,7 @@ type Array struct {
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
-
-	elements := []string{}
-	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
-}
+func (a *Array) Inspect() string  { return inspect(a) }
 
 type HashKey struct {
 	Type  ObjectType
@@ -144,6 +346,10 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -159,22 +365,39 @@ type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-
-	pairs := []string{}
+// SortedPairs returns the pairs ordered by key, so iterating or printing a
+// hash gives the same order every time
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, pair)
 	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-
-	return out.String()
+// keyLess orders hash keys by type first, then by value
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
 }
 
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h) }
+
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -210,3 +433,68 @@ func (f *Macro) Inspect() string {
 
 	return out.String()
 }
+
+// CompiledFunction is a function literal lowered to bytecode by the compiler
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	SourceMap     code.SourceMap
+	NumParameters int
+	// Locals names the slots of the function scope, parameters first
+	Locals []string
+	// Literal is the source of the function, used to print closures
+	Literal *ast.FunctionLiteral
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// CompiledScope describes the slots of a block scope that is entered once
+// per iteration of a for-in loop
+type CompiledScope struct {
+	Locals []string
+}
+
+func (cs *CompiledScope) Type() ObjectType { return COMPILED_SCOPE_OBJ }
+func (cs *CompiledScope) Inspect() string {
+	return "CompiledScope[" + strings.Join(cs.Locals, ", ") + "]"
+}
+
+// Scope holds the local variables of a function call or loop iteration in
+// the vm. Closures keep their defining scope, so captured variables are
+// shared rather than copied.
+type Scope struct {
+	Names []string
+	Slots []Object
+	Outer *Scope
+}
+
+func NewScope(names []string, outer *Scope) *Scope {
+	return &Scope{Names: names, Slots: make([]Object, len(names)), Outer: outer}
+}
+
+// Declares reports whether the scope or one of those enclosing it has a
+// slot for name
+func (s *Scope) Declares(name string) bool {
+	for scope := s; scope != nil; scope = scope.Outer {
+		for _, n := range scope.Names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Closure is a compiled function together with the scope it was created
+// in. It is the vm's counterpart of Function and looks the same to scripts.
+type Closure struct {
+	Fn    *CompiledFunction
+	Scope *Scope
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return inspectFunction(c.Fn.Literal.Parameters, c.Fn.Literal.Body)
+}
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"monkey/token"
+	"strconv"
+	"strings"
+	"testing"
+)
 
 func TestSringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +23,124 @@ func TestSringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have the same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{3.25, "3.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestInspectSelfReference(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "self"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: hash}
+	// a container held twice but not inside itself is rendered in full
+	shared := &Array{Elements: []Object{&Integer{Value: 2}}}
+	pair := &Array{Elements: []Object{shared, shared, hash}}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{array, "[1, [...]]"},
+		{hash, "{self: {...}}"},
+		{pair, "[[2], [2], {self: {...}}]"},
+	}
+	for _, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+	if got := SummarizeArgs([]Object{array}); got != "[1, [...]]" {
+		t.Errorf("wrong summary. got=%q", got)
+	}
+}
+
+func TestSummarizeArgs(t *testing.T) {
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{nil, ""},
+		{[]Object{&Integer{Value: 1}, &String{Value: "a"}}, `1, "a"`},
+		{[]Object{&Function{}, &Builtin{}, nil}, "fn, builtin, nil"},
+		{[]Object{&String{Value: "abcdefghijklmnopqrstuvwxyz"}}, `"abcdefghijklmnopqrst...`},
+	}
+	for _, tt := range tests {
+		if got := SummarizeArgs(tt.args); got != tt.expected {
+			t.Errorf("wrong summary. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestSummarizeLargeArgs(t *testing.T) {
+	const n = 200000
+	array := &Array{Elements: make([]Object, n)}
+	hash := &Hash{Pairs: make(map[HashKey]HashPair, n)}
+	for i := range array.Elements {
+		array.Elements[i] = &Integer{Value: int64(i)}
+		key := &Integer{Value: int64(n - i)}
+		hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: array.Elements[i]}
+	}
+	nested := &Array{Elements: []Object{array, hash}}
+	str := &String{Value: strings.Repeat("ab", n)}
+
+	tests := []struct {
+		arg      Object
+		expected string
+	}{
+		{array, "[0, 1, 2, 3, 4, 5, 6,..."},
+		{hash, "{1: 199999, 2: 199998..."},
+		{nested, "[[0, 1, 2, 3, 4, 5, 6..."},
+		{str, `"abababababababababab...`},
+	}
+	for _, tt := range tests {
+		if got := SummarizeArgs([]Object{tt.arg}); got != tt.expected {
+			t.Errorf("wrong summary. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestDeepErrorStack(t *testing.T) {
+	err := &Error{Message: "deep"}
+	for i := 1; i <= 262144; i++ {
+		err.AddFrame(StackFrame{Function: "f", Args: strconv.Itoa(i)})
+	}
+
+	trace := err.StackTrace()
+	if len(trace) != 21 || err.Omitted != 262124 {
+		t.Fatalf("wrong stack. got %d lines, %d omitted", len(trace), err.Omitted)
+	}
+	if trace[9] != "f(10)" || trace[10] != "... 262124 more calls" || trace[11] != "f(262135)" || trace[20] != "f(262144)" {
+		t.Errorf("wrong stack trace. got=%q", trace)
+	}
+	lines := strings.Split(err.Traceback(), "\n")
+	if len(lines) != 22 || lines[11] != "  ... 262124 more calls" || lines[12] != "  in f(262135)" {
+		t.Errorf("wrong traceback. got=%q", lines)
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	err := &Error{Message: "boom", Stack: []StackFrame{
+		{Function: "inner", Args: "1", Pos: token.Position{Line: 2, Column: 5}},
+		{Pos: token.Position{Line: 3, Column: 1}},
+	}}
+	expected := "ERROR: boom\n  in inner(1), called at 2:5\n  in fn(), called at 3:1"
+	if err.Traceback() != expected {
+		t.Errorf("wrong traceback. want=%q, got=%q", expected, err.Traceback())
+	}
+}
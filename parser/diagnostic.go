@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"monkey/token"
+)
+
+// Severity tells how serious a Diagnostic is
+type Severity int
+
+// SeverityError marks a problem that keeps the program from running
+const SeverityError Severity = iota
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a problem found while lexing or parsing, with the source
+// span it covers and, for syntax errors, the tokens that were expected
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position // start of the offending source
+	End      token.Position // right after the offending source
+	Message  string
+	Expected []token.TokenType // nil when no particular token was expected
+}
+
+// String renders the diagnostic as file:line:col: message
+func (d Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return d.Pos.String() + ": " + d.Message
+	}
+	return d.Message
+}
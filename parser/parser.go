@@ -1,11 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 type (
@@ -16,11 +18,15 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      // =
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // ** binds tighter than prefix: -2 ** 2 == -(2 ** 2)
 	CALL        // myFunction(X)
 	INDEX       //array[index]
 )
@@ -28,23 +34,41 @@ const (
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.OR:       OR,
+	token.AND:      AND,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.POWER:    POWER,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
 }
 
 // Parser intakes Lexer and creates AST
 type Parser struct {
 	l *lexer.Lexer
 
-	curToken  token.Token
-	peekToken token.Token
-	errors    []string
+	curToken    token.Token
+	peekToken   token.Token
+	diagnostics []Diagnostic
+	lexErrors   int  // lexer errors already copied into diagnostics
+	loopDepth   int  // loops enclosing curToken inside the present function
+	quoteDepth  int  // quote calls enclosing curToken
+	braceDepth  int  // `{` left open by the tokens before curToken
+	recovering  bool // a syntax error was reported; skip to the next statement
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -53,19 +77,22 @@ type Parser struct {
 // New get new parser
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
@@ -81,6 +108,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -91,8 +130,26 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Parse parses src and returns the program together with every diagnostic.
+// With errors the program is partial: broken statements are left out.
+func Parse(file, src string) (*ast.Program, []Diagnostic) {
+	p := New(lexer.NewFile(file, src))
+	program := p.ParseProgram()
+	return program, p.Diagnostics()
+}
+
+// Diagnostics returns the structured lexing and parsing problems
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// Errors returns the parse errors, each prefixed with its file:line:col
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, 0, len(p.diagnostics))
+	for _, d := range p.diagnostics {
+		errors = append(errors, d.String())
+	}
+	return errors
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -103,15 +160,86 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func (p *Parser) peekError(t token.TokenType) {
+func (p *Parser) peekError(expected ...token.TokenType) {
+	names := make([]string, 0, len(expected))
+	for _, t := range expected {
+		names = append(names, string(t))
+	}
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+		strings.Join(names, " or "), p.peekToken.Type)
+	p.syntaxError(p.peekToken, msg, expected...)
+}
+
+// syntaxError reports a token the grammar does not allow here. Only the first
+// one is kept until the parser resynchronizes, so errors do not cascade.
+func (p *Parser) syntaxError(tok token.Token, msg string, expected ...token.TokenType) {
+	if p.recovering {
+		return
+	}
+	p.recovering = true
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Message:  msg,
+		Expected: expected,
+	})
+}
+
+// appendError reports an error that leaves the parsed tree well formed
+func (p *Parser) appendError(tok token.Token, msg string) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Message:  msg,
+	})
+}
+
+// synchronize skips the rest of a broken statement that started at brace
+// depth `depth`. It stops on the `;` ending it or before a `}` or a keyword
+// starting the next statement, and reports whether it instead left the
+// enclosing block, standing on or past its closing `}`.
+func (p *Parser) synchronize(depth int) bool {
+	p.recovering = false
+
+	for !p.curTokenIs(token.EOF) {
+		if p.braceDepth < depth {
+			return true
+		}
+		if p.braceDepth == depth {
+			switch p.curToken.Type {
+			case token.RBRACE:
+				return true
+			case token.SEMICOLON:
+				return false
+			}
+		}
+
+		next := p.braceDepth
+		if p.curTokenIs(token.LBRACE) {
+			next++
+		} else if p.curTokenIs(token.RBRACE) {
+			next--
+		}
+		if next == depth && (p.peekTokenIs(token.RBRACE) || startsStatement(p.peekToken.Type)) {
+			return false
+		}
+
+		p.nextToken()
+	}
+
+	return false
 }
 
-func (p *Parser) appendError(msg string) {
-	p.errors = append(p.errors, msg)
+func startsStatement(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.THROW:
+		return true
+	}
+	return false
 }
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -127,8 +255,27 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) nextToken() {
+	switch {
+	case p.curTokenIs(token.LBRACE):
+		p.braceDepth++
+	case p.curTokenIs(token.RBRACE) && p.braceDepth > 0:
+		p.braceDepth--
+	}
+
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// surface scanning errors, e.g. unterminated strings, as parse errors
+	lexErrors := p.l.Errors()
+	for ; p.lexErrors < len(lexErrors); p.lexErrors++ {
+		err := lexErrors[p.lexErrors]
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Severity: SeverityError,
+			Pos:      err.Pos,
+			End:      err.Pos,
+			Message:  err.Msg,
+		})
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -136,8 +283,12 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
+		depth := p.braceDepth
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.recovering {
+			// drop the broken statement; a stray `}` is skipped as well
+			p.synchronize(depth)
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -151,20 +302,30 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 // let x = oneExpression;
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.parseBindingName()
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -175,8 +336,12 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// parseExpression parse single exp only & will not forward token postion
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
-		//p.appendError(fmt.Sprintf("redundant token %s", p.curToken.Literal))
+	// name the function for stack traces
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -184,17 +349,130 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 }
 
 // return x = oneExpression;
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// throw x = oneExpression;
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// while (condition) { body }
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// for (value in iterable) { body } or for (key, value in iterable) { body }
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = p.parseBindingName()
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = p.parseBindingName()
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, where break and continue are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
+
+// break;
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.appendError(p.curToken, "break outside loop")
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	return stmt
+}
 
+// continue;
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.appendError(p.curToken, "continue outside loop")
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
@@ -213,7 +491,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.syntaxError(p.curToken, msg)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -266,10 +544,28 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
+	// base 0 accepts 0x, 0o, 0b prefixes and _ separators
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
+	if errors.Is(err, strconv.ErrRange) {
+		msg := fmt.Sprintf("integer literal %s overflows int64", p.curToken.Literal)
+		p.appendError(p.curToken, msg)
+	} else if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.appendError(p.curToken, msg)
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.appendError(p.curToken, msg)
 	}
 
 	lit.Value = value
@@ -296,16 +592,49 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.POWER) {
+		// right associative: 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	exp.Right = p.parseExpression(precedence)
 
 	return exp
 }
 
+// x = exp; x += exp; arr[i] = exp; assignment is right associative
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case *ast.CallExpression:
+		// a macro template can assign to the identifier it unquotes
+		if target.Function.TokenLiteral() != "unquote" {
+			p.appendError(p.curToken, fmt.Sprintf("cannot assign to %s", target))
+		}
+	default:
+		p.appendError(p.curToken, fmt.Sprintf("cannot assign to %s", target))
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.Null{Token: p.curToken}
+}
+
 func (p *Parser) parseGroupExpression() ast.Expression {
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
@@ -346,6 +675,50 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+// try { block } catch (e) { catch } finally { finally }, with at least
+// one of catch and finally
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Block = p.parseBlockStatement()
+
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		p.peekError(token.CATCH, token.FINALLY)
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		exp.Param = p.parseBindingName()
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	return exp
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	b := &ast.BlockStatement{Token: p.curToken}
 	b.Statements = []ast.Statement{}
@@ -353,13 +726,23 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		depth := p.braceDepth
 		s := p.parseStatement()
-		if s != nil {
+		if p.recovering {
+			// drop the broken statement; stop if it ran into the closing `}`
+			if p.synchronize(depth) {
+				break
+			}
+		} else if s != nil {
 			b.Statements = append(b.Statements, s)
 		}
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBRACE) {
+		b.Rbrace = p.curToken
+	}
+
 	return b
 }
 
@@ -375,7 +758,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue cannot cross a function boundary
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
@@ -390,14 +777,12 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	// parse the first param that no COMMA in front
 	p.nextToken()
-	id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	ids = append(ids, id)
+	ids = append(ids, p.parseBindingName())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		ids = append(ids, id)
+		ids = append(ids, p.parseBindingName())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -407,9 +792,29 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return ids
 }
 
+// parseBindingName parses the name at curToken that a let, a parameter, a
+// loop or a catch binds. Inside a quote call the name can be an unquote
+// call, which gives the name when the quote is evaluated.
+func (p *Parser) parseBindingName() *ast.Identifier {
+	id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.quoteDepth == 0 || !p.curTokenIs(token.IDENT) || id.Value != "unquote" || !p.peekTokenIs(token.LPAREN) {
+		return id
+	}
+	p.nextToken()
+	id.Unquote, _ = p.parseCallExpression(&ast.Identifier{Token: id.Token, Value: id.Value}).(*ast.CallExpression)
+	return id
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	if id, ok := function.(*ast.Identifier); ok && id.Value == "quote" {
+		p.quoteDepth++
+		defer func() { p.quoteDepth-- }()
+	}
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.curToken
+	}
 	return exp
 }
 
@@ -443,9 +848,12 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	array := &ast.ArrayLiteral{}
+	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		array.Rbracket = p.curToken
+	}
 
 	return array
 }
@@ -483,6 +891,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken
 
 	return exp
 }
@@ -504,14 +913,19 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		hash.Pairs[key] = value
 
-		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+		if !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.COMMA) {
+			p.peekError(token.COMMA, token.RBRACE)
 			return nil
 		}
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
 	}
 
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken
 
 	return hash
 }
@@ -527,7 +941,10 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 
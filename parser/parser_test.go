@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
 	"testing"
 )
 
@@ -68,7 +69,7 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 }
 
 func checkParsrErrors(t *testing.T, p *Parser) {
-	errors := p.errors
+	errors := p.Errors()
 	if len(errors) == 0 {
 		return
 	}
@@ -188,6 +189,98 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff;", 255},
+		{"0XFF;", 255},
+		{"0o17;", 15},
+		{"0b1010;", 10},
+		{"1_000_000;", 1000000},
+		{"0xdead_beef;", 0xdeadbeef},
+		{"9223372036854775807;", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParsrErrors(t, p)
+
+		s := program.Statements[0].(*ast.ExpressionStatement)
+		il, ok := s.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", s.Expression)
+		}
+		if il.Value != tt.expected {
+			t.Errorf("il.Value not %d. got=%d", tt.expected, il.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808;", "1:1: integer literal 9223372036854775808 overflows int64"},
+		{"0b102;", `1:1: could not parse "0b102" as integer`},
+		{"1__0;", `1:1: could not parse "1__0" as integer`},
+		{"0x;", `1:1: could not parse "0x" as integer`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q. got=%v", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E+3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParsrErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program not enough statement. got=%d", len(program.Statements))
+		}
+		s, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("prgram.Statement[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		fl, ok := s.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", s.Expression)
+		}
+		if fl.Value != tt.expected {
+			t.Errorf("fl.Value not %g. got=%g", tt.expected, fl.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -338,6 +431,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}{
 		{"-a * b", "((-a) * b)"},
 		{"!-a", "(!(-a))"},
+		{"!null == x", "((!null) == x)"},
 		{"a + b + c", "((a + b) + c)"},
 		{"a + b -c", "((a + b) - c)"},
 		{"a * b * c", "((a * b) * c)"},
@@ -361,6 +455,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])),(b[1]),(2 * ([1, 2][1])))",
 		},
+		{"a <= b == b >= a", "((a <= b) == (b >= a))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"a * b ** c", "(a * (b ** c))"},
 	}
 
 	for _, tt := range tests {
@@ -779,3 +881,398 @@ func TestMacroLiteralExpression(t *testing.T) {
 
 	testInfixExpression(t, b.Expression, "x", "+", "y")
 }
+
+func TestUnquotedBindingNames(t *testing.T) {
+	input := `quote(fn(unquote(a), b) { let unquote(c) = 1; for (unquote(k), v in []) {}; try {} catch (unquote(e)) {} })`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParsrErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	fn, ok := call.Arguments[0].(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("quoted node is not *ast.FunctionLiteral. got=%T", call.Arguments[0])
+	}
+	let := fn.Body.Statements[0].(*ast.LetStatement)
+	loop := fn.Body.Statements[1].(*ast.ForStatement)
+	try := fn.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+
+	tests := []struct {
+		id       *ast.Identifier
+		expected string // the unquote call, empty for a plain name
+	}{
+		{fn.Parameters[0], "unquote(a)"},
+		{fn.Parameters[1], ""},
+		{let.Name, "unquote(c)"},
+		{loop.Key, "unquote(k)"},
+		{loop.Value, ""},
+		{try.Param, "unquote(e)"},
+	}
+	for _, tt := range tests {
+		if tt.expected == "" {
+			if tt.id.Unquote != nil {
+				t.Errorf("%s has an unquote call", tt.id)
+			}
+			continue
+		}
+		if tt.id.Unquote == nil || tt.id.Unquote.String() != tt.expected {
+			t.Errorf("wrong unquote call. want=%s, got=%v", tt.expected, tt.id.Unquote)
+		}
+	}
+
+	// outside of a quote an unquote call cannot stand for a name
+	p = New(lexer.New("let unquote(c) = 1;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected a parser error for a let of an unquote call outside of a quote")
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "1:5: expected next token to be IDENT, got = instead"},
+		{"let x = 1;\nlet y 2;", "2:7: expected next token to be =, got INT instead"},
+		{`let s = "open;`, "1:9: unterminated string literal"},
+		{`let s = "\q";`, `1:10: unknown escape sequence: \q`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	input := "let add = fn(a, b) { a + b };\nadd(1, [2, 3][0]);"
+
+	l := lexer.NewFile("span.mk", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParsrErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	index := call.Arguments[1].(*ast.IndexExpression)
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{program, "span.mk:1:1", "span.mk:2:18"},
+		{let, "span.mk:1:1", "span.mk:1:29"},
+		{fn, "span.mk:1:11", "span.mk:1:29"},
+		{fn.Body, "span.mk:1:20", "span.mk:1:29"},
+		{fn.Body.Statements[0], "span.mk:1:22", "span.mk:1:27"},
+		{call, "span.mk:2:1", "span.mk:2:18"},
+		{index, "span.mk:2:8", "span.mk:2:17"},
+		{index.Left, "span.mk:2:8", "span.mk:2:14"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedStart {
+			t.Errorf("tests[%d] - %q start wrong. want=%s, got=%s",
+				i, tt.node.String(), tt.expectedStart, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - %q end wrong. want=%s, got=%s",
+				i, tt.node.String(), tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x; }", "while(x < 10) x"},
+		{"for (x in [1, 2]) { x; };", "for (x in [1, 2]) x"},
+		{"for (k, v in h) { break; continue; }", "for (k, v in h) break;continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParsrErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected = %q, got = %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestForStatementVariables(t *testing.T) {
+	l := lexer.New("for (k, v in h) { v }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParsrErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Key, "k") {
+		return
+	}
+	if !testIdentifier(t, stmt.Value, "v") {
+		return
+	}
+	if !testIdentifier(t, stmt.Iterable, "h") {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body does not contain 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (true) { continue; }", "1:13: continue outside loop"},
+		{"while (true) { fn() { break; } }", "1:23: break outside loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q. got=%v", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "x = 5"},
+		{"x += y * 2;", "x += (y * 2)"},
+		{"x = y = 3;", "x = y = 3"},
+		{"arr[1] -= 1;", "(arr[1]) -= 1"},
+		{`h["k"] /= 2; h["k"] %= 2; h["k"] *= 2`, `(h[k]) /= 2(h[k]) %= 2(h[k]) *= 2`},
+		{"unquote(a) = unquote(b);", "unquote(a) = unquote(b)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParsrErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected = %q, got = %q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("x = y = 3;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParsrErrors(t, p)
+
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("exp is not *ast.AssignExpression. got=%T", program.Statements[0])
+	}
+	if _, ok := exp.Value.(*ast.AssignExpression); !ok {
+		t.Errorf("assignment is not right associative. got=%T", exp.Value)
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + x = 5;", "1:7: cannot assign to (1 + x)"},
+		{"f(x) = 5;", "1:6: cannot assign to f(x)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=[%q], got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			"let = 5 + + 2; let y = 2; y;",
+			[]string{"1:5: expected next token to be IDENT, got = instead"},
+			"let y = 2;y",
+		},
+		{
+			"let a = (1 + ; let b = 2;\nlet c = ) ; c",
+			[]string{
+				"1:14: no prefix parse function for ; found",
+				"2:9: no prefix parse function for ) found",
+			},
+			"let b = 2;c",
+		},
+		{
+			"let f = fn(x) { let = 1; x + 1 }; f(1)",
+			[]string{"1:21: expected next token to be IDENT, got = instead"},
+			"let f = fn(x) (x + 1);f(1)",
+		},
+		{
+			"let f = fn(x) { x + }; f(1)",
+			[]string{"1:21: no prefix parse function for } found"},
+			"let f = fn(x) ;f(1)",
+		},
+		{
+			"} let x = 1;",
+			[]string{"1:1: no prefix parse function for } found"},
+			"let x = 1;",
+		},
+		{
+			`{"a" 1, "b": 2}; 3`,
+			[]string{`1:6: expected next token to be :, got INT instead`},
+			"3",
+		},
+		{
+			`{"a": 1 "b": 2}; 3`,
+			[]string{`1:9: expected next token to be , or }, got STRING instead`},
+			"3",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q", tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+			}
+		}
+		if program.String() != tt.expectedStatements {
+			t.Errorf("wrong partial program. want=%q, got=%q", tt.expectedStatements, program.String())
+		}
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	program, diagnostics := Parse("d.mk", "let x 5;\nlet s = \"open")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("partial program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("wrong number of diagnostics. got=%d (%v)", len(diagnostics), diagnostics)
+	}
+
+	d := diagnostics[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity. got=%s", d.Severity)
+	}
+	if d.Pos.String() != "d.mk:1:7" || d.End.String() != "d.mk:1:8" {
+		t.Errorf("wrong span. got=%s-%s", d.Pos, d.End)
+	}
+	if d.Message != "expected next token to be =, got INT instead" {
+		t.Errorf("wrong message. got=%q", d.Message)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN {
+		t.Errorf("wrong expected tokens. got=%v", d.Expected)
+	}
+
+	if diagnostics[1].String() != "d.mk:2:9: unterminated string literal" {
+		t.Errorf("wrong lexer diagnostic. got=%q", diagnostics[1].String())
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"let x = try { 1 } catch (e) { 2 } finally { 3 };", "let x = try 1 catch (e) 2 finally 3;"},
+		{`throw "boom";`, "throw boom;"},
+		{`if (x) { throw {"message": x} }`, "ifx throw {message:x};"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParsrErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected = %q, got = %q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "1:10: expected next token to be CATCH or FINALLY, got EOF instead"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { instead"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
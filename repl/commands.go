@@ -0,0 +1,215 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"monkey/vm"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command is a meta-command, entered as :name followed by its argument
+type command struct {
+	args string // what the argument is, empty for none
+	help string
+	run  func(s *session, arg string, interrupts <-chan os.Signal)
+}
+
+// commands are set up in init as :help lists them
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"tokens": {"<src>", "list the tokens of src", (*session).tokens},
+		"ast":    {"<src>", "print the syntax tree of src", (*session).ast},
+		"expand": {"<src>", "print src with its macros expanded", (*session).expand},
+		"env":    {"", "list the bindings of the session", (*session).listEnv},
+		"load":   {"<file>", "run file in the session", (*session).load},
+		"reset":  {"", "drop the bindings and macros of the session", (*session).reset},
+		"time":   {"<src>", "run src and print how long it took", (*session).time},
+		"help":   {"", "list the commands", (*session).help},
+	}
+}
+
+// isCommand reports whether input is a meta-command rather than Monkey
+// source, which never starts with a colon
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+// splitCommand splits the meta-command input into its name and argument
+func splitCommand(input string) (name, arg string) {
+	input = strings.TrimPrefix(strings.TrimSpace(input), ":")
+	if i := strings.IndexAny(input, " \t\n"); i >= 0 {
+		return input[:i], strings.TrimSpace(input[i:])
+	}
+	return input, ""
+}
+
+// needsMore reports whether input continues on the next line, as
+// incomplete Monkey source does, also as the argument of a command
+func needsMore(input string) bool {
+	if isCommand(input) {
+		name, arg := splitCommand(input)
+		if commands[name].args != "<src>" {
+			return false
+		}
+		input = arg
+	}
+	return incomplete(input)
+}
+
+// command runs the meta-command input
+func (s *session) command(input string, interrupts <-chan os.Signal) {
+	name, arg := splitCommand(input)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command :%s, :help lists the commands\n", name)
+		return
+	}
+	if cmd.args != "" && arg == "" {
+		fmt.Fprintf(s.out, "usage: :%s %s\n", name, cmd.args)
+		return
+	}
+	cmd.run(s, arg, interrupts)
+}
+
+func (s *session) tokens(src string, _ <-chan os.Signal) {
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(s.out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	for _, err := range l.Errors() {
+		io.WriteString(s.out, "\t"+err.Error()+"\n")
+	}
+}
+
+// parse parses src, reporting its syntax errors
+func (s *session) parse(src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+func (s *session) ast(src string, _ <-chan os.Signal) {
+	if program, ok := s.parse(src); ok {
+		io.WriteString(s.out, ast.Dump(program))
+	}
+}
+
+func (s *session) expand(src string, interrupts <-chan os.Signal) {
+	program, ok := s.parse(src)
+	if !ok {
+		return
+	}
+	ctx, stop := interruptible(interrupts)
+	defer stop()
+
+	// the macros src defines apply to it but are not kept
+	macroEnv := object.NewEnclosedEnvironment(s.macroEnv)
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, diagnostics := evaluator.ExpandContext(ctx, program, macroEnv, object.Limits{})
+	if len(diagnostics) != 0 {
+		if ctx.Err() != nil {
+			// the terminal echoed ^C
+			io.WriteString(s.out, "\n")
+		}
+		printDiagnostics(s.out, diagnostics)
+		return
+	}
+	io.WriteString(s.out, expanded.String()+"\n")
+}
+
+func (s *session) listEnv(_ string, _ <-chan os.Signal) {
+	if s.engine == EngineVM {
+		for i, name := range s.symbolTable.Names() {
+			// builtins and names used before their let have no value
+			if value, ok := vm.GlobalValue(s.globals, i); ok {
+				fmt.Fprintf(s.out, "%s = %s\n", name, describe(value))
+			}
+		}
+	} else {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, describe(value))
+		}
+	}
+	for _, name := range s.macroEnv.Names() {
+		value, _ := s.macroEnv.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, describe(value))
+	}
+}
+
+// describe renders a binding on one line: functions and macros by their
+// parameters, strings quoted and other values as they print
+func describe(obj object.Object) string {
+	params := func(identifiers []*ast.Identifier) string {
+		names := make([]string, len(identifiers))
+		for i, identifier := range identifiers {
+			names[i] = identifier.Value
+		}
+		return strings.Join(names, ", ")
+	}
+
+	switch obj := obj.(type) {
+	case nil:
+		// bound to a statement, such as an empty block, that gives nothing
+		return "null"
+	case *object.Function:
+		return "fn(" + params(obj.Parameters) + ")"
+	case *object.Closure:
+		return "fn(" + params(obj.Fn.Literal.Parameters) + ")"
+	case *object.Macro:
+		return "macro(" + params(obj.Parameters) + ")"
+	case *object.String:
+		return strconv.Quote(obj.Value)
+	default:
+		return obj.Inspect()
+	}
+}
+
+func (s *session) load(file string, interrupts <-chan os.Signal) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(s.out, "%s\n", err)
+		return
+	}
+	s.eval(file, string(src), interrupts)
+}
+
+func (s *session) reset(_ string, _ <-chan os.Signal) {
+	*s = *newSession(s.streams, s.out, s.engine)
+}
+
+func (s *session) time(src string, interrupts <-chan os.Signal) {
+	start := time.Now()
+	s.eval("", src, interrupts)
+	fmt.Fprintf(s.out, "took %s\n", time.Since(start).Round(time.Microsecond))
+}
+
+func (s *session) help(_ string, _ <-chan os.Signal) {
+	for _, name := range []string{"tokens", "ast", "expand", "env", "load", "reset", "time", "help"} {
+		cmd := commands[name]
+		usage := ":" + name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		fmt.Fprintf(s.out, "%-16s %s\n", usage, cmd.help)
+	}
+}
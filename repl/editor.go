@@ -0,0 +1,211 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/object"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted ends a line on which Ctrl-C was pressed
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the input of the REPL a line at a time
+type lineReader interface {
+	// ReadLine shows prompt and returns the next line without its line
+	// ending, io.EOF once the input ended
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from input that is not a terminal
+type plainReader struct {
+	streams *object.IO
+	out     io.Writer
+}
+
+func (r plainReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	return r.streams.ReadLine()
+}
+
+// editor reads lines from a terminal, switching it to raw mode so a line
+// can be edited in place and the history recalled with the arrow keys
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+	// raw switches the terminal to raw mode and returns how to restore it
+	raw func() (restore func(), err error)
+}
+
+func ctrl(key rune) rune { return key & 0x1f }
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := e.raw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line []rune
+	cursor := 0
+	// recalled indexes the history entry shown, len(entries) while the
+	// line being entered, kept in pending, is shown
+	recalled := len(e.history.entries)
+	var pending []rune
+
+	recall := func(index int) {
+		if recalled == len(e.history.entries) {
+			pending = line
+		}
+		recalled = index
+		if index == len(e.history.entries) {
+			line = pending
+		} else {
+			line = []rune(e.history.entries[index])
+		}
+		cursor = len(line)
+	}
+
+	for {
+		e.refresh(prompt, line, cursor)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			io.WriteString(e.out, "\n")
+			if err == io.EOF && len(line) > 0 {
+				e.history.Add(string(line))
+				return string(line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\n")
+			e.history.Add(string(line))
+			return string(line), nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(line) == 0 {
+				io.WriteString(e.out, "\n")
+				return "", io.EOF
+			}
+			line, cursor = deleteRune(line, cursor)
+		case 127, ctrl('H'):
+			if cursor > 0 {
+				line, cursor = deleteRune(line, cursor-1)
+			}
+		case ctrl('A'):
+			cursor = 0
+		case ctrl('E'):
+			cursor = len(line)
+		case ctrl('B'):
+			if cursor > 0 {
+				cursor--
+			}
+		case ctrl('F'):
+			if cursor < len(line) {
+				cursor++
+			}
+		case ctrl('U'):
+			line, cursor = line[cursor:], 0
+		case ctrl('K'):
+			line = line[:cursor]
+		case ctrl('P'):
+			if recalled > 0 {
+				recall(recalled - 1)
+			}
+		case ctrl('N'):
+			if recalled < len(e.history.entries) {
+				recall(recalled + 1)
+			}
+		case 27:
+			switch e.readEscape() {
+			case 'A':
+				if recalled > 0 {
+					recall(recalled - 1)
+				}
+			case 'B':
+				if recalled < len(e.history.entries) {
+					recall(recalled + 1)
+				}
+			case 'C':
+				if cursor < len(line) {
+					cursor++
+				}
+			case 'D':
+				if cursor > 0 {
+					cursor--
+				}
+			case 'H':
+				cursor = 0
+			case 'F':
+				cursor = len(line)
+			case '~':
+				if cursor < len(line) {
+					line, cursor = deleteRune(line, cursor)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+				cursor++
+			}
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence a key sent and returns
+// the key it names: A to D for the arrow keys, H for Home, F for End and
+// ~ for Delete, 0 for the keys the editor does not handle
+func (e *editor) readEscape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r < '0' || r > '9' {
+		return r
+	}
+
+	// ESC [ n ~
+	var n strings.Builder
+	for ; r >= '0' && r <= '9'; r, _, err = e.in.ReadRune() {
+		n.WriteRune(r)
+	}
+	if err != nil || r != '~' {
+		return 0
+	}
+	switch n.String() {
+	case "1", "7":
+		return 'H'
+	case "4", "8":
+		return 'F'
+	case "3":
+		return '~'
+	}
+	return 0
+}
+
+// refresh redraws the line and puts the terminal cursor at cursor
+func (e *editor) refresh(prompt string, line []rune, cursor int) {
+	var out strings.Builder
+	out.WriteString("\r" + prompt + string(line) + "\x1b[K")
+	if back := len(line) - cursor; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+	io.WriteString(e.out, out.String())
+}
+
+func deleteRune(line []rune, i int) ([]rune, int) {
+	return append(line[:i:i], line[i+1:]...), i
+}
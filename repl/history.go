@@ -0,0 +1,68 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// maxHistory bounds the lines a history keeps
+const maxHistory = 1000
+
+// history holds the lines entered in the REPL, oldest first, and appends
+// them to its file so they outlive the session
+type history struct {
+	entries []string
+	file    string // none if empty
+}
+
+// loadHistory reads the history kept in file, which need not exist
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	if file == "" {
+		return h
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		// keep the file from growing without bound
+		os.WriteFile(file, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+	}
+	return h
+}
+
+// Add records line unless it is blank or repeats the last line
+func (h *history) Add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if h.file == "" {
+		return
+	}
+	// the history is a convenience, failing to save it is not an error
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
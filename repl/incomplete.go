@@ -0,0 +1,67 @@
+package repl
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+)
+
+// continuing are the tokens that cannot end an input, as an operand or an
+// element must follow them
+var continuing = map[token.TokenType]bool{
+	token.ASSIGN:          true,
+	token.PLUS:            true,
+	token.MINUS:           true,
+	token.BANG:            true,
+	token.ASTERISK:        true,
+	token.SLASH:           true,
+	token.PERCENT:         true,
+	token.POWER:           true,
+	token.PLUS_ASSIGN:     true,
+	token.MINUS_ASSIGN:    true,
+	token.ASTERISK_ASSIGN: true,
+	token.SLASH_ASSIGN:    true,
+	token.PERCENT_ASSIGN:  true,
+	token.LT:              true,
+	token.GT:              true,
+	token.LT_EQ:           true,
+	token.GT_EQ:           true,
+	token.EQ:              true,
+	token.NOT_EQ:          true,
+	token.AND:             true,
+	token.OR:              true,
+	token.COMMA:           true,
+	token.COLON:           true,
+}
+
+// incomplete reports whether src needs more lines: it leaves a bracket, a
+// string or a block comment open or ends with an operator. Input closing
+// more brackets than it opens is complete, so the parser reports it.
+func incomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+	var last token.TokenType
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+		last = tok.Type
+	}
+
+	for _, err := range l.Errors() {
+		if strings.HasPrefix(err.Msg, "unterminated") {
+			return true
+		}
+	}
+	return depth > 0 || continuing[last]
+}
@@ -1,47 +1,211 @@
 package repl
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"monkey/compiler"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"os/signal"
+	"strings"
 )
 
 const PROMT = ">> "
 
+// CONT_PROMT asks for the next line of an incomplete input
+const CONT_PROMT = ".. "
+
+// Engine selects the backend that runs the programs
+type Engine string
+
+const (
+	EngineEval Engine = "eval"
+	EngineVM   Engine = "vm"
+)
+
+// Options configure a REPL session
+type Options struct {
+	Engine Engine
+	// HistoryFile keeps the lines entered on a terminal across sessions,
+	// the history is not kept if it is empty
+	HistoryFile string
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
+	StartEngine(in, out, EngineEval)
+}
+
+// StartEngine runs the REPL on the given backend
+func StartEngine(in io.Reader, out io.Writer, engine Engine) {
+	Run(in, out, Options{Engine: engine})
+}
+
+// Run runs the REPL until its input ends. The programs it runs read from
+// in, as the REPL does, and write to out. On a terminal the lines can be
+// edited and recalled from the history, and Ctrl-C cancels the input being
+// entered or the running evaluation.
+func Run(in io.Reader, out io.Writer, opts Options) {
+	s := newSession(object.NewIO(in, out, out), out, opts.Engine)
+
+	var lines lineReader = plainReader{streams: s.streams, out: out}
+	var interrupts chan os.Signal
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		lines = &editor{
+			in:      s.streams.In,
+			out:     out,
+			history: loadHistory(opts.HistoryFile),
+			raw:     func() (func(), error) { return makeRaw(f) },
+		}
+		interrupts = make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		defer signal.Stop(interrupts)
+	}
 
 	for {
-		fmt.Print(PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(lines)
+		if err == errInterrupted {
+			continue
+		}
+		if isCommand(input) {
+			s.command(input, interrupts)
+		} else if input != "" {
+			s.eval("", input, interrupts)
+		}
+		if err != nil {
 			return
 		}
+	}
+}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+// readInput reads lines until they form a complete input. It returns what
+// it read so far along with an error ending the input.
+func readInput(lines lineReader) (string, error) {
+	var input strings.Builder
+	prompt := PROMT
+	for {
+		line, err := lines.ReadLine(prompt)
+		if err != nil {
+			return input.String(), err
+		}
+		input.WriteString(line)
+		if !needsMore(input.String()) {
+			return input.String(), nil
+		}
+		input.WriteString("\n")
+		prompt = CONT_PROMT
+	}
+}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+// session is the state the inputs of a REPL share
+type session struct {
+	engine  Engine
+	streams *object.IO
+	out     io.Writer
+
+	env      *object.Environment
+	macroEnv *object.Environment
+
+	// state the vm keeps between inputs
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func newSession(streams *object.IO, out io.Writer, engine Engine) *session {
+	s := &session{
+		engine:      engine,
+		streams:     streams,
+		out:         out,
+		env:         object.NewEnvironment(),
+		macroEnv:    object.NewEnvironment(),
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+	}
+	s.env.SetIO(s.streams)
+	return s
+}
+
+// eval runs input, read from file if it is not empty, and prints its
+// value. A signal on interrupts cancels the evaluation.
+func (s *session) eval(file, input string, interrupts <-chan os.Signal) {
+	l := lexer.NewFile(file, input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+
+	ctx, stop := interruptible(interrupts)
+	defer stop()
+
+	evaluator.DefineMacros(program, s.macroEnv)
+	expanded, diagnostics := evaluator.ExpandContext(ctx, program, s.macroEnv, object.Limits{})
+	if len(diagnostics) != 0 {
+		if ctx.Err() != nil {
+			// the terminal echoed ^C
+			io.WriteString(s.out, "\n")
 		}
+		printDiagnostics(s.out, diagnostics)
+		return
+	}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+	var evaluated object.Object
+	if s.engine == EngineVM {
+		comp := compiler.NewWithState(s.symbolTable, s.constants)
+		if err := comp.Compile(expanded); err != nil {
+			fmt.Fprintf(s.out, "compilation failed: %s\n", err)
+			return
+		}
+		bytecode := comp.Bytecode()
+		s.constants = bytecode.Constants
+		machine := vm.NewWithGlobalsState(bytecode, s.globals)
+		machine.SetIO(s.streams)
+		evaluated = machine.RunContext(ctx, object.Limits{})
+	} else {
+		evaluated = evaluator.EvalContext(ctx, expanded, s.env, object.Limits{})
+	}
+	if ctx.Err() != nil {
+		// the terminal echoed ^C
+		io.WriteString(s.out, "\n")
+	}
 
-		evaluated := evaluator.Eval(expanded, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	if err, ok := evaluated.(*object.Error); ok {
+		io.WriteString(s.out, err.Traceback())
+		io.WriteString(s.out, "\n")
+	} else if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// interruptible returns a context cancelled by a signal on interrupts,
+// until stop is called
+func interruptible(interrupts <-chan os.Signal) (ctx context.Context, stop func()) {
+	// drop a Ctrl-C pressed after the previous evaluation ended
+	select {
+	case <-interrupts:
+	default:
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-done:
 		}
+	}()
+	return ctx, func() {
+		close(done)
+		cancel()
 	}
 }
 
@@ -50,3 +214,10 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+// printDiagnostics prints diagnostics as printParserErrors does
+func printDiagnostics(out io.Writer, diagnostics []parser.Diagnostic) {
+	for _, d := range diagnostics {
+		io.WriteString(out, "\t"+d.String()+"\n")
+	}
+}
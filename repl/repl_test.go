@@ -0,0 +1,287 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartEngineIO(t *testing.T) {
+	// readline reads the line following its call from the REPL's input
+	input := "let x = 2;\nputs(x * 3)\nlet line = readline();\nfrom stdin\nline\n"
+	expected := ">> >> 6\nnull\n>> >> from stdin\n>> "
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		var out strings.Builder
+		StartEngine(strings.NewReader(input), &out, engine)
+
+		if out.String() != expected {
+			t.Errorf("wrong output on %s. got=%q, want=%q", engine, out.String(), expected)
+		}
+	}
+}
+
+func TestMultilineInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a +\n    b\n};\nadd(1,\n2)\nlet s = \"a\nb\"; s\n(1))\n"
+	expected := ">> .. .. .. >> .. 3\n>> .. a\nb\n>> \t1:4: no prefix parse function for ) found\n>> "
+
+	var out strings.Builder
+	Start(strings.NewReader(input), &out)
+	if out.String() != expected {
+		t.Errorf("wrong output. got=%q, want=%q", out.String(), expected)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	input := "let two = macro(a, b) { quote(unquote(a) + unquote(b)) };\ntwo(1)\ntwo(1, 2)\n"
+	expected := ">> >> \t1:1: macro two: wrong number of arguments. got=1, want=2\n>> 3\n>> "
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		var out strings.Builder
+		StartEngine(strings.NewReader(input), &out, engine)
+		if out.String() != expected {
+			t.Errorf("wrong output on %s. got=%q, want=%q", engine, out.String(), expected)
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) { x }", false},
+		{"[1, 2", true},
+		{"{\"a\": 1,", true},
+		{"f(1)(", true},
+		{"1 +", true},
+		{"let x =", true},
+		{"a &&", true},
+		{"x += ", true},
+		{"1 + 2 // comment", false},
+		{"1 + // comment", true},
+		{"\"open string", true},
+		{"`raw", true},
+		{"/* open comment", true},
+		{"1 }", false},
+		{"{ 1 }}", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) = %t, want %t", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestEditor(t *testing.T) {
+	const (
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		right = "\x1b[C"
+		left  = "\x1b[D"
+		home  = "\x1b[H"
+		del   = "\x1b[3~"
+	)
+
+	tests := []struct {
+		keys     string
+		history  []string
+		expected []string
+		err      error
+	}{
+		{"abc\r", nil, []string{"abc"}, io.EOF},
+		{"abc" + left + left + "X\r", nil, []string{"aXbc"}, io.EOF},
+		{"abc\x7f\x7fd\r", nil, []string{"ad"}, io.EOF},
+		{"abc" + home + del + "\x05!\r", nil, []string{"bc!"}, io.EOF},
+		{"abc\x01\x06\x0b\r", nil, []string{"a"}, io.EOF},
+		{"héllo" + left + "\x15\r", nil, []string{"o"}, io.EOF},
+		{up + "\r", []string{"one", "two"}, []string{"two"}, io.EOF},
+		{up + up + up + "\r", []string{"one", "two"}, []string{"one"}, io.EOF},
+		{"new" + up + down + "\r", []string{"one"}, []string{"new"}, io.EOF},
+		{up + "!" + right + "\r", []string{"one"}, []string{"one!"}, io.EOF},
+		{"first\rsecond", nil, []string{"first", "second"}, io.EOF},
+		{"abc\x03", nil, nil, errInterrupted},
+		{"\x04", nil, nil, io.EOF},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := &editor{
+			in:      bufio.NewReader(strings.NewReader(tt.keys)),
+			out:     &out,
+			history: &history{entries: tt.history},
+			raw:     func() (func(), error) { return func() {}, nil },
+		}
+
+		var lines []string
+		var err error
+		for {
+			var line string
+			line, err = e.ReadLine(PROMT)
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+		}
+
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("keys %q: wrong lines. got=%q, want=%q", tt.keys, lines, tt.expected)
+		}
+		if err != tt.err {
+			t.Errorf("keys %q: wrong error. got=%v, want=%v", tt.keys, err, tt.err)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+
+	h := loadHistory(file)
+	for _, line := range []string{"let x = 1;", "", "x", "x", "  ", "x + 1"} {
+		h.Add(line)
+	}
+	expected := []string{"let x = 1;", "x", "x + 1"}
+	if !reflect.DeepEqual(h.entries, expected) {
+		t.Errorf("wrong entries. got=%q, want=%q", h.entries, expected)
+	}
+
+	// a later session starts from the saved history
+	if got := loadHistory(file).entries; !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong loaded entries. got=%q, want=%q", got, expected)
+	}
+
+	long := strings.Repeat("line\n", maxHistory+10)
+	if err := os.WriteFile(file, []byte(long), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(loadHistory(file).entries); got != maxHistory {
+		t.Errorf("history keeps %d entries, want %d", got, maxHistory)
+	}
+}
+
+func TestInterruptEvaluation(t *testing.T) {
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		var out strings.Builder
+		s := newSession(object.NewIO(nil, &out, &out), &out, engine)
+
+		interrupts := make(chan os.Signal, 1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			interrupts <- os.Interrupt
+		}()
+		s.eval("", "let n = 0; while (true) { n += 1 }", interrupts)
+
+		if !strings.HasPrefix(out.String(), "\nERROR: ") || !strings.Contains(out.String(), "evaluation cancelled: context canceled") {
+			t.Errorf("wrong output on %s. got=%q", engine, out.String())
+		}
+
+		// the session goes on with its state
+		out.Reset()
+		s.eval("", "n > 0", nil)
+		if out.String() != "true\n" {
+			t.Errorf("wrong output after the interrupt on %s. got=%q", engine, out.String())
+		}
+	}
+}
+
+func TestInterruptExpansion(t *testing.T) {
+	var out strings.Builder
+	s := newSession(object.NewIO(nil, &out, &out), &out, EngineEval)
+
+	interrupts := make(chan os.Signal, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		interrupts <- os.Interrupt
+	}()
+	s.eval("", "let m = macro() { while (true) { } }; m()", interrupts)
+
+	if !strings.HasPrefix(out.String(), "\n") || !strings.Contains(out.String(), "macro m: 1:32: evaluation cancelled: context canceled") {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestCommands(t *testing.T) {
+	lib := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(lib, []byte("let sq = fn(x) { x * x };\nsq(3)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`:tokens let x = "a";`,
+		":ast -f(y)",
+		"let m = macro(a) { quote(unquote(a) + 1) };",
+		":expand m(2) * m(",
+		"3)",
+		"let s = \"str\";",
+		":env",
+		":load " + lib,
+		":time sq(4)",
+		":reset",
+		"s",
+		":nope",
+		":ast",
+		":load",
+		":load " + lib + ".missing",
+	}, "\n")
+
+	expected := `>> 1:1	LET	"let"
+1:5	IDENT	"x"
+1:7	=	"="
+1:9	STRING	"a"
+1:12	;	";"
+1:13	EOF	""
+>> Program 1:1
+  Statements[0]: ExpressionStatement 1:1
+    Expression: PrefixExpression 1:1 Operator="-"
+      Right: CallExpression 1:2
+        Function: Identifier 1:2 Value="f"
+        Arguments[0]: Identifier 1:4 Value="y"
+>> >> .. ((2 + 1) * (3 + 1))
+>> >> s = "str"
+m = macro(a)
+>> 9
+>> 16
+took <elapsed>
+>> >> ERROR: 1:1: identifier not found: s
+>> unknown command :nope, :help lists the commands
+>> usage: :ast <src>
+>> usage: :load <file>
+>> open ` + lib + `.missing: no such file or directory
+>> `
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		var out strings.Builder
+		StartEngine(strings.NewReader(input), &out, engine)
+
+		got := regexp.MustCompile(`took \S+`).ReplaceAllString(out.String(), "took <elapsed>")
+		if got != expected {
+			t.Errorf("wrong output on %s. got=\n%s\nwant=\n%s", engine, got, expected)
+		}
+	}
+}
+
+func TestLoadPositions(t *testing.T) {
+	lib := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(lib, []byte("let f = fn() { 1 + true };\nf()"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	Start(strings.NewReader(":load "+lib), &out)
+
+	expected := ">> ERROR: " + lib + ":1:16: type mismatch: INTEGER + BOOLEAN\n  in f(), called at " + lib + ":2:1\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output. got=%q, want=%q", out.String(), expected)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package repl
+
+import (
+	"errors"
+	"os"
+)
+
+// the editor needs a unix terminal, elsewhere the REPL reads plain lines
+
+func isTerminal(f *os.File) bool { return false }
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
@@ -0,0 +1,295 @@
+package vm
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// programs run on both backends, which must agree on every result
+var differentialPrograms = []string{
+	// literals and operators
+	`5`,
+	`-7 + 3 * (2 - 10) / 4`,
+	`7 % 3; -7 % 3`,
+	`2 ** 10; 2 ** -1`,
+	`1.5 + 2; 7 / 2.0; 2.0 ** 0.5`,
+	`1 < 2; 2 <= 2; 3 >= 4; 1 == 1.0; 2 != 3`,
+	`true == true; true != false; !5; !!0; !null`,
+	`"foo" + "bar"`,
+	`"a" == "a"`,
+	`[1, "two", 3.0, [4]]`,
+	`{"a": 1, 2: true, false: "x"}`,
+	`{}`,
+	`[]`,
+
+	// conditionals and logic
+	`if (1 < 2) { 10 } else { 20 }`,
+	`if (false) { 10 }`,
+	`if (null) { 1 } else { 2 }`,
+	`if (true) { let x = 1; }`,
+	`false && undefined; true || undefined`,
+	`1 && "yes"; null || 0`,
+
+	// bindings, scopes and closures
+	`let a = 5; let b = a * 2; a + b`,
+	`let a = 1; let a = a + 1; a`,
+	`let x = 5`,
+	`5; let y = 1;`,
+	`let f = fn(x) { x * 2 }; f(21)`,
+	`fn() { }()`,
+	`let add = fn(a, b) { a + b }; add(1)`,
+	`let add = fn(a, b) { a + b }; add(1, 2, 3)`,
+	`let newAdder = fn(x) { fn(y) { x + y } }; newAdder(2)(3)`,
+	`let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()`,
+	`let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n`,
+	`let f = fn() { let a = fn() { b() }; let b = fn() { 7 }; a() }; f()`,
+	`let x = 1; let f = fn() { let y = x + 1; let x = 10; x + y }; f()`,
+	`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)`,
+	`let f = fn(n) { let g = fn(m) { if (m == 0) { return 0; } g(m - 1) }; g(n) }; f(10)`,
+	`let map = fn(arr, f) { let iter = fn(arr, acc) { if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) } }; iter(arr, [0]) }; map([1, 2, 3], fn(x) { x * x })`,
+	`let f = fn(x) { x }; f`,
+	`len`,
+	`let len = fn(x) { 42 }; len([1])`,
+	`return 5; 10`,
+	`let f = fn() { return 1; 2 }; f()`,
+
+	// tail calls
+	`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)`,
+	`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)`,
+	`let f = fn(n) { for (x in [1, 2]) { if (n > 0) { return f(n - 1); } } "done" }; f(1000)`,
+	`let f = fn(a, b) { a }; let g = fn() { f(1) }; g()`,
+	`let f = fn() { len(1) }; f()`,
+	`let f = fn() { 5() }; f()`,
+	`let f = fn(x) { x }; return f(3); 4`,
+	`let f = fn(x) { x }; return f();`,
+
+	// stack traces
+	`let inner = fn(x) { x + true };
+let outer = fn(a, b) { 1 + inner(a) };
+outer(1, "some rather long string argument")`,
+	`let f = fn(n) { if (n == 0) { foo } else { f(n - 1) } }; f(3)`,
+	`let f = fn(n) { if (n == 0) { foo } else { 1 + f(n - 1) } }; f(3)`,
+	`let apply = fn(g, x) { 1 + g(x) }; apply(fn(y) { y / 0 }, 5)`,
+	`let f = fn() { for (x in [1]) { let g = fn() { len(x) }; return 1 + g(); } }; f()`,
+
+	// exceptions
+	`try { 1 / 0 } catch (e) { [e["type"], e["message"]] }`,
+	`try { 1 } catch (e) { 2 }`,
+	`let x = try { foo } catch (e) { e["type"] }; x`,
+	`try { len(1) } catch (e) { e }`,
+	`try { len(1, 2) } catch (e) { e["type"] }`,
+	`try { int("x") } catch (e) { e["type"] }`,
+	`try { [1][5] = 0 } catch (e) { e["type"] }`,
+	`try { throw "boom" } catch (e) { e }`,
+	`try { throw {"type": "MyError", "message": "bad"} } catch (e) { e["type"] + ": " + e["message"] }`,
+	`try { throw 42 } catch (e) { e["message"] }`,
+	`try { throw {"code": 42} } catch (e) { [e, e["value"]["code"]] }`,
+	`try { throw [1] } catch (e) { try { throw e } catch (e) { e["value"]["value"] } }`,
+	`throw {"message": "uncaught"}`,
+	`try { throw {"type": "CancelledError", "message": "x"} } catch (e) { e }`,
+	`throw {"type": "LimitError", "message": "x"}`,
+	`let f = fn() { throw "deep" }; let g = fn(x) { f() + x }; try { g(1) } catch (e) { e["stack"] }`,
+	`let f = fn(n) { if (n == 0) { throw "done" } else { f(n - 1) } }; try { f(100) } catch (e) { e["stack"] }`,
+	`let log = [0]; try { log = push(log, 1) } finally { log = push(log, 2) }; log`,
+	`let log = [0]; try { try { 1 / 0 } finally { log = push(log, 1) } } catch (e) { log = push(log, e["type"]) }; log`,
+	`let log = [0]; try { 1 / 0 } catch (e) { log = push(log, 1) } finally { log = push(log, 2) }; log`,
+	`let log = [0]; try { 1 / 0 } catch (e) { foo } finally { log = push(log, 2) }`,
+	`let log = [0]; let f = fn() { try { return 1 } finally { log = push(log, 2) } }; [f(), log]`,
+	`let f = fn() { try { return 1 } finally { return 2 } }; f()`,
+	`let f = fn() { try { throw "x" } finally { return 2 } }; f()`,
+	`let f = fn() { try { 1 } catch (e) { 2 } finally { throw "from finally" } }; f()`,
+	`let f = fn(n) { if (n > 2) { throw "big" } n }; let g = fn(n) { try { return f(n) } catch (e) { return -1 } }; [g(1), g(5)]`,
+	`let f = fn(n) { if (n > 2) { throw "big" } n }; let g = fn(n) { try { return if (n > 0) { f(n) } } catch (e) { -1 } }; [g(1), g(5)]`,
+	`let f = fn(n) { 1 / n }; let g = fn(n) { try { f(n) } catch (e) { return f(n + 1) } finally { 0 } }; [g(1), g(0), g(-1)]`,
+	`let f = fn(n) { 1 / n }; let g = fn(n) { try { f(n) } catch (e) { f(n + 1) + f(0) } }; g(0)`,
+	`let log = [0]; for (x in [1, 2, 3]) { try { if (x == 2) { continue } if (x == 3) { break } log = push(log, x) } finally { log = push(log, -x) } } log`,
+	`let log = [0]; let i = 0; while (i < 5) { i += 1; try { if (i == 3) { break } } catch (e) { 0 } finally { log = push(log, i) } } [i, log]`,
+	`let log = [0]; for (x in [1, 2]) { try { x / 0 } catch (e) { if (x == 1) { continue } log = push(log, e["message"]) } } log`,
+	`let f = fn() { for (x in [1, 2]) { try { throw x } catch (e) { for (y in [3]) { return [e["message"], y] } } } }; f()`,
+	`for (x in [1]) { try { throw "a" } catch (e) { let inner = e } }; inner`,
+	`let fs = [0]; for (x in [1, 2]) { try { throw x } catch (e) { fs = push(fs, fn() { e["message"] }) } } fs[1]() + fs[2]()`,
+	`let e = "outer"; try { throw "inner" } catch (e) { e }; e`,
+	`let f = fn() { try { let a = 1; a / 0 } catch (e) { let b = 2 } finally { let c = 3 }; [a, c] }; f()`,
+	`try { try { throw "a" } catch (e) { throw e["message"] + "b" } } catch (e) { e["message"] }`,
+	`try { try { throw {"type": "T", "message": "m"} } catch (e) { throw e } } catch (e) { [e["type"], e["message"]] }`,
+	`let f = fn(n) { try { if (n == 0) { throw "bottom" } f(n - 1) } finally { 0 } }; f(3)`,
+
+	// loops
+	`let i = 0; let sum = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue; } sum += i; } sum`,
+	`let i = 0; while (true) { i += 1; if (i > 5) { break; } } i`,
+	`let i = 0; while (i < 3) { i += 1 }`,
+	`let s = 0; for (x in [1, 2, 3]) { s += x } s`,
+	`let s = ""; let n = 0; for (i, c in "héllo") { s = c + s; n += i } [s, n]`,
+	`let s = []; for (k, v in {"b": 2, "a": 1}) { s = push(s, [k, v]) } s`,
+	`let s = []; for (k in {"b": 2, "a": 1}) { s = push(s, k) } s`,
+	`let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) } fs[0]() + fs[2]()`,
+	`let s = 0; for (x in [1, 2, 3, 4, 5]) { if (x == 4) { break; } if (x == 2) { continue; } s += x; } s`,
+	`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 100; } } 0 }; f()`,
+	`for (x in [1]) { let inner = x; } inner`,
+	`let r = []; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } r = push(r, x + y) } } r`,
+
+	// assignment
+	`let a = [1, 2, 3]; a[1] = 5; a[2] *= 10; a`,
+	`let h = {"k": 1}; h["k"] += 1; h["j"] = 0; h`,
+	`let x = 1; x += 2; x -= 1; x *= 10; x /= 4; x %= 3; x`,
+	`y = 1`,
+	`let a = [1]; a[5] = 1`,
+	`let s = "x"; s[0] = "y"`,
+
+	// builtins
+	`len("héllo"); runelen("héllo")`,
+	`first([7, 8]); last([7, 8]); rest([7, 8])`,
+	`push([1], 2)`,
+	`int("0x1f") + int(2.9); float("1.5")`,
+	`len(1)`,
+
+	// errors and their positions
+	`5 + true;`,
+	`let f = fn() {
+  1 + "a"
+};
+f()`,
+	`-true`,
+	`foobar`,
+	`{[1]: 2}`,
+	`1 / 0`,
+	`9223372036854775807 + 1`,
+	`5()`,
+	`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10000000)`,
+	`for (x in 5) { }`,
+	`[1, 2][true]`,
+	`x += 1`,
+
+	// a function ending in a loop returns null
+	`let each = fn(xs) { for (x in xs) { x } }; each([1]) == null`,
+	`let each = fn(xs) { for (x in xs) { x } }; each([1]) + 1`,
+	`let each = fn(xs) { for (x in xs) { x } }; [each([1])]`,
+	`let each = fn(xs) { for (x in xs) { x } }; {each([1]): 1}`,
+	`let each = fn(xs) { for (x in xs) { x } }; for (y in each([1])) {}`,
+	`let count = fn(n) { let i = 0; while (i < n) { i += 1 } }; [count(3), fn() {}()]`,
+
+	// a variable bound to nothing is defined
+	`let f = fn() {}; let r = f(); r`,
+	`let r = if (true) { }; r`,
+	`let each = fn(xs) { for (x in xs) { x } }; let x = 0; x = each([1]); x`,
+	`let x = 1; let f = fn() { let x = if (false) { 1 }; x }; f()`,
+	`let x = 1; let f = fn() { let y = 2; y = if (false) { 1 }; y }; f()`,
+	`let x = 1; let f = fn(x) { x }; f(if (false) { 1 })`,
+
+	// quote and unquote
+	`quote(1 + 2)`,
+	`let x = 8; quote(unquote(x) + unquote(1 + 1))`,
+	`let f = fn(n) { quote(unquote(n) * 2) }; f(1); f(2)`,
+	`quote(unquote(quote(a + b)) * c)`,
+	`quote(unquote("a") + unquote([1, 2.5, null]) + unquote({"k": fn(x) { x }}))`,
+	`let n = 1; quote(unquote(fn(x) { x + n }))`,
+	`let f = fn(y) { fn(a) { a + y } }; quote(unquote(f(1)))`,
+	`let f = fn() { let y = 2; let g = fn() { y }; quote(unquote(g)) }; f()`,
+	`quote(unquote(len))`,
+	`quote(1 + unquote(1 / 0))`,
+	`let args = [quote(a), 2]; quote(f(unquote_splice(args), [unquote_splice(args)]))`,
+	`quote(if (x) { unquote_splice([quote(y), 1]) })`,
+	`quote(f(unquote_splice(1)))`,
+	`let a = [1]; a[0] = a; a`,
+	`let h = {"k": 1}; h["self"] = h; [h, h["self"]["self"]["k"]]`,
+	`quote(-unquote_splice([1]))`,
+	`let g = quote(n); quote(fn(unquote(g)) { let unquote(g) = 1; for (unquote(g) in []) {}; try {} catch (unquote(g)) {} })`,
+	`let x = 1; quote(fn() { let unquote(x) = 2 })`,
+}
+
+func TestDifferential(t *testing.T) {
+	for _, input := range differentialPrograms {
+		want := inspect(runEval(t, input))
+		got := inspect(runVM(t, input))
+		if got != want {
+			t.Errorf("backends disagree on %q:\neval: %s\nvm:   %s", input, want, got)
+		}
+	}
+}
+
+// TestDifferentialMacros expands macros once and runs the result on both backends
+// the call depth and allocation limits count the same in both backends;
+// steps do not, the vm counts instructions
+func TestDifferentialLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits object.Limits
+	}{
+		{`let f = fn(n) { 1 + f(n + 1) }; f(0)`, object.Limits{MaxCallDepth: 20}},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100)`, object.Limits{MaxCallDepth: 1}},
+		{`let f = fn(n) { try { 1 + f(n + 1) } catch (e) { 0 } }; f(0)`, object.Limits{MaxCallDepth: 5}},
+		{`let s = "ab"; while (true) { s += s }`, object.Limits{MaxAllocations: 1000}},
+		{`let a = [1]; for (x in [1, 2, 3]) { a = push(a, {"x": [x]}) } a`, object.Limits{MaxAllocations: 12}},
+		{`let a = [1]; for (x in [1, 2, 3]) { a = push(a, {"x": [x]}) } a`, object.Limits{MaxAllocations: 11}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		want := inspect(evaluator.EvalContext(context.Background(), program, object.NewEnvironment(), tt.limits))
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error on %q: %s", tt.input, err)
+		}
+		got := inspect(New(comp.Bytecode()).RunContext(context.Background(), tt.limits))
+		if got != want {
+			t.Errorf("backends disagree on %q:\neval: %s\nvm:   %s", tt.input, want, got)
+		}
+	}
+}
+
+func TestDifferentialMacros(t *testing.T) {
+	input := `
+let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons); } else { unquote(alt); }); };
+let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+let double = macro(v) { let g = gensym("n"); quote(fn(unquote(g)) { unquote(g) * 2 }(unquote(v))) };
+[unless(10 > 5, "no", "yes"), twice(21), twice(1), double(21)]`
+
+	want := inspect(runEval(t, input))
+	got := inspect(runVM(t, input))
+	if got != want {
+		t.Errorf("backends disagree:\neval: %s\nvm:   %s", want, got)
+	}
+}
+
+func runEval(t *testing.T, input string) object.Object {
+	program := parse(t, input)
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func runVM(t *testing.T, input string) object.Object {
+	program := parse(t, input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error on %q: %s", input, err)
+	}
+	return New(comp.Bytecode()).Run()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors on %q: %v", input, p.Errors())
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv).(*ast.Program)
+}
+
+// inspect describes a result for comparison, errors with their stack trace
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nothing>"
+	}
+	if err, ok := obj.(*object.Error); ok {
+		return err.Traceback()
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// Frame is a function call in progress
+type Frame struct {
+	cl  *object.Closure
+	ins code.Instructions
+	ip  int
+	// basePointer is the stack pointer when the call started. The callee
+	// and its arguments stay on the stack right below it until the call
+	// returns, so a stack trace can show them.
+	basePointer int
+	numArgs     int
+	// scope holds the locals, it changes while for-in bodies run
+	scope *object.Scope
+
+	// the call instruction that started the frame
+	callFn *object.CompiledFunction
+	callIP int
+}
+
+func NewFrame(cl *object.Closure, basePointer, numArgs int, scope *object.Scope) *Frame {
+	return &Frame{
+		cl:          cl,
+		ins:         cl.Fn.Instructions,
+		ip:          -1,
+		basePointer: basePointer,
+		numArgs:     numArgs,
+		scope:       scope,
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.ins
+}
+
+// args returns the arguments of the call from the stack
+func (f *Frame) args(stack []object.Object) []object.Object {
+	return stack[f.basePointer-f.numArgs : f.basePointer]
+}
+
+// stackFrame describes the frame for a stack trace
+func (f *Frame) stackFrame(stack []object.Object) object.StackFrame {
+	return object.StackFrame{
+		Function: f.cl.Fn.Literal.Name,
+		Args:     object.SummarizeArgs(f.args(stack)),
+		Pos:      f.callFn.SourceMap.Lookup(f.callIP),
+	}
+}
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"monkey/object"
+	"unicode/utf8"
+)
+
+// iterator walks the iterable of a for-in loop; it lives on the stack
+// while the loop runs and is never visible to scripts
+type iterator struct {
+	next func() (key, value object.Object, ok bool)
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// newIterator yields the same keys and values as the evaluator's for-in:
+// index and element for arrays, rune index and character for strings and
+// key and value, ordered by key, for hashes. A loop with a single variable
+// over a hash binds the keys, so keysOnly yields them as values too.
+func newIterator(iterable object.Object, keysOnly bool) (*iterator, bool) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		i := 0
+		return &iterator{next: func() (object.Object, object.Object, bool) {
+			if i >= len(iterable.Elements) {
+				return nil, nil, false
+			}
+			key := &object.Integer{Value: int64(i)}
+			value := iterable.Elements[i]
+			i++
+			return key, value, true
+		}}, true
+
+	case *object.String:
+		offset, i := 0, 0
+		return &iterator{next: func() (object.Object, object.Object, bool) {
+			if offset >= len(iterable.Value) {
+				return nil, nil, false
+			}
+			ch, size := utf8.DecodeRuneInString(iterable.Value[offset:])
+			key := &object.Integer{Value: int64(i)}
+			offset += size
+			i++
+			return key, &object.String{Value: string(ch)}, true
+		}}, true
+
+	case *object.Hash:
+		pairs := iterable.SortedPairs()
+		i := 0
+		return &iterator{next: func() (object.Object, object.Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			pair := pairs[i]
+			i++
+			if keysOnly {
+				return pair.Key, pair.Key, true
+			}
+			return pair.Key, pair.Value, true
+		}}, true
+
+	default:
+		return nil, false
+	}
+}
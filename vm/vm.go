@@ -0,0 +1,746 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536
+	// MaxFrames bounds the frames, the calls of Monkey functions and the
+	// main program
+	MaxFrames = object.MaxCallDepth + 1
+)
+
+// the vm shares the evaluator's singletons, so identity comparisons such
+// as true == true behave the same in both backends
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+// binaryOperators maps the binary opcodes to their operators
+var binaryOperators [256]string
+
+func init() {
+	for op, operator := range compiler.Operators {
+		binaryOperators[op] = operator
+	}
+}
+
+type VM struct {
+	constants []object.Object
+
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top is stack[sp-1]
+
+	frames []*Frame
+
+	handlers []handler
+
+	// budget limits the run, nil if it is not limited
+	budget *object.Budget
+	// io holds the streams the builtins use
+	io *object.IO
+
+	lastPopped object.Object
+}
+
+// handler is where an error raised in a try expression continues
+type handler struct {
+	frame int // index of the frame that installed the handler
+	ip    int
+	sp    int
+	scope *object.Scope
+	catch bool // the target is a catch block rather than a finally block
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsState(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsState creates a vm that shares globals with earlier runs,
+// as the REPL does
+func NewWithGlobalsState(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0, 0, nil)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.Globals,
+		stack:       make([]object.Object, StackSize),
+		frames:      []*Frame{mainFrame},
+		io:          object.StdIO,
+	}
+}
+
+// SetIO makes the builtins the program calls use streams, nil restores
+// object.StdIO
+func (vm *VM) SetIO(streams *object.IO) {
+	if streams == nil {
+		streams = object.StdIO
+	}
+	vm.io = streams
+}
+
+// RunContext runs the program like Run, but aborts with a LimitError or a
+// CancelledError, which try expressions do not catch, once the run exceeds
+// limits or ctx is done. Steps count executed instructions.
+func (vm *VM) RunContext(ctx context.Context, limits object.Limits) object.Object {
+	vm.budget = object.NewBudget(ctx, limits)
+	defer func() { vm.budget = nil }()
+
+	return vm.Run()
+}
+
+// Run executes the program and returns what it evaluates to, like
+// evaluator.Eval does: the value of the last statement, the value of a
+// top level return or the first error.
+func (vm *VM) Run() object.Object {
+	for {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+		if frame.ip >= len(ins)-1 {
+			return vm.lastPopped
+		}
+
+		frame.ip++
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		var err *object.Error
+		if vm.budget != nil {
+			if err = vm.budget.Step(); err != nil {
+				err.Pos = frame.cl.Fn.SourceMap.Lookup(ip)
+				return vm.unwind(err)
+			}
+		}
+
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.constants[idx])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpTrue:
+			vm.push(True)
+		case code.OpFalse:
+			vm.push(False)
+		case code.OpNull:
+			vm.push(Null)
+		case code.OpNil:
+			vm.push(nil)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.allocate(binaryOperation(op, left, right)))
+
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.PrefixOperation("-", vm.pop()))
+		case code.OpBang:
+			err = vm.pushResult(evaluator.PrefixOperation("!", vm.pop()))
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpGetGlobal:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			err = vm.pushResult(vm.getGlobal(idx))
+
+		case code.OpSetGlobal:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[idx] = toSlot(vm.pop())
+
+		case code.OpAssignGlobal:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			binary := code.Opcode(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			var current object.Object
+			if binary != 0 {
+				current = vm.getGlobal(idx)
+			}
+			err = vm.assign(&vm.globals[idx], vm.globalNames[idx], binary, current)
+
+		case code.OpGetLocal:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			idx := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+			err = vm.pushResult(vm.getLocal(frame.scope, depth, idx))
+
+		case code.OpSetLocal:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			frame.scope.Slots[idx] = toSlot(vm.pop())
+
+		case code.OpAssignLocal:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			idx := int(code.ReadUint16(ins[ip+2:]))
+			binary := code.Opcode(code.ReadUint8(ins[ip+4:]))
+			frame.ip += 4
+			var current object.Object
+			if binary != 0 {
+				current = vm.getLocal(frame.scope, depth, idx)
+			}
+			scope := outerScope(frame.scope, depth)
+			err = vm.assign(&scope.Slots[idx], scope.Names[idx], binary, current)
+
+		case code.OpEnterScope:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			compiled := vm.constants[idx].(*object.CompiledScope)
+			frame.scope = object.NewScope(compiled.Locals, frame.scope)
+
+		case code.OpExitScope:
+			frame.scope = frame.scope.Outer
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			err = vm.pushResult(vm.allocate(&object.Array{Elements: elements}))
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+			if err == nil {
+				err = vm.pushResult(vm.allocate(hash))
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.IndexOperation(left, index))
+
+		case code.OpSetIndex:
+			binary := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			index := vm.pop()
+			left := vm.pop()
+			value := vm.pop()
+			if binary != 0 {
+				current := evaluator.IndexOperation(left, index)
+				if isError(current) {
+					err = current.(*object.Error)
+					break
+				}
+				value = vm.allocate(binaryOperation(binary, current, value))
+				if isError(value) {
+					err = value.(*object.Error)
+					break
+				}
+			}
+			err = vm.pushResult(evaluator.IndexAssignment(left, index, value))
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.callFunction(numArgs)
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			err = vm.tailCall(numArgs)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if len(vm.frames) == 1 {
+				// a return at the top level ends the program
+				return returnValue
+			}
+			returning := vm.popFrame()
+			if vm.budget != nil {
+				vm.budget.LeaveCall()
+			}
+			vm.sp = returning.basePointer - returning.numArgs - 1
+			// a body ending in a statement, such as a loop, gives nothing
+			if returnValue == nil {
+				returnValue = Null
+			}
+			vm.push(returnValue)
+
+		case code.OpClosure:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			fn := vm.constants[idx].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Scope: frame.scope})
+
+		case code.OpIter:
+			keysOnly := code.ReadUint8(ins[ip+1:]) == 1
+			frame.ip += 1
+			iterable := vm.pop()
+			it, ok := newIterator(iterable, keysOnly)
+			if !ok {
+				err = newError(object.TypeError, "cannot iterate over %s", iterable.Type())
+				break
+			}
+			vm.push(it)
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			it := vm.stack[vm.sp-1].(*iterator)
+			key, value, ok := it.next()
+			if !ok {
+				vm.pop()
+				frame.ip = pos - 1
+				break
+			}
+			vm.push(value)
+			vm.push(key)
+
+		case code.OpQuote:
+			idx := code.ReadUint16(ins[ip+1:])
+			numValues := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			values := make([]object.Object, numValues)
+			copy(values, vm.stack[vm.sp-numValues:vm.sp])
+			vm.sp -= numValues
+			err = vm.pushResult(unquote(vm.constants[idx].(*object.Quote), values))
+
+		case code.OpSetupCatch, code.OpSetupFinally:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				frame: len(vm.frames) - 1,
+				ip:    pos,
+				sp:    vm.sp,
+				scope: frame.scope,
+				catch: op == code.OpSetupCatch,
+			})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			value := vm.pop()
+			if thrown, ok := value.(*object.Error); ok {
+				err = thrown
+			} else {
+				err = evaluator.ThrownError(value)
+			}
+
+		default:
+			err = newError("", "unknown opcode %d", op)
+		}
+
+		if err != nil {
+			if !err.Pos.IsValid() {
+				err.Pos = frame.cl.Fn.SourceMap.Lookup(ip)
+			}
+			if vm.handle(err) {
+				continue
+			}
+			return vm.unwind(err)
+		}
+	}
+}
+
+// unwind adds the calls in progress to the stack of an error ending the run
+func (vm *VM) unwind(err *object.Error) *object.Error {
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		err.AddFrame(vm.frames[i].stackFrame(vm.stack))
+	}
+	return err
+}
+
+// handle unwinds the stack to the innermost handler and continues at its
+// target, adding a stack frame to err for every call it leaves. It reports
+// false if there is no handler.
+func (vm *VM) handle(err *object.Error) bool {
+	if len(vm.handlers) == 0 || !err.Catchable() {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	for i := len(vm.frames) - 1; i > h.frame; i-- {
+		err.AddFrame(vm.frames[i].stackFrame(vm.stack))
+		if vm.budget != nil {
+			vm.budget.LeaveCall()
+		}
+	}
+	vm.frames = vm.frames[:h.frame+1]
+
+	frame := vm.currentFrame()
+	frame.ip = h.ip - 1
+	frame.scope = h.scope
+	vm.sp = h.sp
+	if h.catch {
+		vm.push(evaluator.CaughtError(err))
+	} else {
+		vm.push(err)
+	}
+	return true
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+func (vm *VM) callFunction(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		fn := callee.Fn
+		if numArgs < fn.NumParameters {
+			return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", numArgs, fn.NumParameters)
+		}
+		if len(vm.frames) >= MaxFrames {
+			return newError(object.RecursionError, "stack overflow: call depth exceeds %d", object.MaxCallDepth)
+		}
+		if vm.budget != nil {
+			if err := vm.budget.EnterCall(); err != nil {
+				return err
+			}
+		}
+
+		// extra arguments are ignored, as in the evaluator
+		scope := object.NewScope(fn.Locals, callee.Scope)
+		setParameters(scope, vm.stack[vm.sp-numArgs:vm.sp-numArgs+fn.NumParameters])
+
+		caller := vm.currentFrame()
+		frame := NewFrame(callee, vm.sp, numArgs, scope)
+		frame.callFn, frame.callIP = caller.cl.Fn, caller.ip
+		vm.frames = append(vm.frames, frame)
+		return nil
+
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+		return vm.pushResult(vm.allocate(callee.Call(vm.io, args...)))
+
+	default:
+		return newError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+// tailCall runs a call to a closure in the frame of the current function,
+// which is done once the call returns. Other callees, and calls from the
+// top level, are called normally; the OpReturnValue following the call
+// returns their result.
+func (vm *VM) tailCall(numArgs int) *object.Error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || len(vm.frames) == 1 {
+		return vm.callFunction(numArgs)
+	}
+
+	frame := vm.currentFrame()
+	fn := callee.Fn
+	if numArgs < fn.NumParameters {
+		// the current function is done, as in the evaluator it is not
+		// part of the stack trace
+		vm.popFrame()
+		if vm.budget != nil {
+			vm.budget.LeaveCall()
+		}
+		return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", numArgs, fn.NumParameters)
+	}
+
+	scope := object.NewScope(fn.Locals, callee.Scope)
+	setParameters(scope, vm.stack[vm.sp-numArgs:vm.sp-numArgs+fn.NumParameters])
+
+	// move the callee and arguments down to where the current ones are
+	start := frame.basePointer - frame.numArgs - 1
+	copy(vm.stack[start:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	callFn, callIP := frame.cl.Fn, frame.ip
+	*frame = *NewFrame(callee, start+1+numArgs, numArgs, scope)
+	frame.callFn, frame.callIP = callFn, callIP
+	vm.sp = frame.basePointer
+	return nil
+}
+
+// binaryOperation applies a binary opcode. Integer arithmetic that cannot
+// overflow and integer comparisons are computed here, everything else is
+// left to the evaluator's operators.
+func binaryOperation(op code.Opcode, left, right object.Object) object.Object {
+	l, ok := left.(*object.Integer)
+	if !ok {
+		return evaluator.InfixOperation(binaryOperators[op], left, right)
+	}
+	r, ok := right.(*object.Integer)
+	if !ok {
+		return evaluator.InfixOperation(binaryOperators[op], left, right)
+	}
+
+	switch op {
+	case code.OpAdd:
+		if sum := l.Value + r.Value; (sum > l.Value) == (r.Value > 0) {
+			return &object.Integer{Value: sum}
+		}
+	case code.OpSub:
+		if diff := l.Value - r.Value; (diff < l.Value) == (r.Value > 0) {
+			return &object.Integer{Value: diff}
+		}
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(l.Value < r.Value)
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(l.Value > r.Value)
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(l.Value <= r.Value)
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(l.Value >= r.Value)
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(l.Value == r.Value)
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(l.Value != r.Value)
+	}
+	return evaluator.InfixOperation(binaryOperators[op], left, right)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// allocate charges a value the run created to its budget, if any
+func (vm *VM) allocate(obj object.Object) object.Object {
+	if vm.budget == nil {
+		return obj
+	}
+	if err := vm.budget.Allocate(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// pushResult pushes the result of an operation, or returns it if it is an error
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) getGlobal(idx int) object.Object {
+	if val := vm.globals[idx]; val != nil {
+		return fromSlot(val)
+	}
+
+	name := vm.globalNames[idx]
+	if builtin, ok := evaluator.LookupBuiltin(name); ok {
+		return builtin
+	}
+	return newError(object.NameError, "identifier not found: %s", name)
+}
+
+// getLocal reads a slot of the scope depth levels out. A slot without a
+// value has not been defined yet, so the name is looked up outwards like
+// the evaluator's environments would.
+func (vm *VM) getLocal(scope *object.Scope, depth, idx int) object.Object {
+	declaring := outerScope(scope, depth)
+	if val := declaring.Slots[idx]; val != nil {
+		return fromSlot(val)
+	}
+
+	name := declaring.Names[idx]
+	if slot := vm.lookupSlot(declaring.Outer, name); slot != nil {
+		return fromSlot(*slot)
+	}
+	if builtin, ok := evaluator.LookupBuiltin(name); ok {
+		return builtin
+	}
+	return newError(object.NameError, "identifier not found: %s", name)
+}
+
+// assign implements an assignment to slot, or to the binding the name
+// falls back to if slot has no value yet. binary is the opcode of a
+// compound operator and current the value it is applied to.
+func (vm *VM) assign(slot *object.Object, name string, binary code.Opcode, current object.Object) *object.Error {
+	value := vm.pop()
+
+	if binary != 0 {
+		if isError(current) {
+			return current.(*object.Error)
+		}
+		value = vm.allocate(binaryOperation(binary, current, value))
+		if isError(value) {
+			return value.(*object.Error)
+		}
+	}
+
+	if *slot == nil {
+		slot = vm.lookupSlot(vm.currentFrame().scope, name)
+		if slot == nil {
+			return newError(object.NameError, "cannot assign to undeclared identifier: %s", name)
+		}
+	}
+	*slot = toSlot(value)
+	vm.push(value)
+	return nil
+}
+
+// nothing fills the slot of a variable bound to the nil value of a
+// statement, such as an empty block, since a nil slot is one whose
+// variable has not been defined yet
+var nothing object.Object = &nothingValue{}
+
+type nothingValue struct{}
+
+func (n *nothingValue) Type() object.ObjectType { return "NOTHING" }
+func (n *nothingValue) Inspect() string         { return "" }
+
+// toSlot returns what a slot holds for value
+func toSlot(value object.Object) object.Object {
+	if value == nil {
+		return nothing
+	}
+	return value
+}
+
+// fromSlot returns the value a slot defined holds
+func fromSlot(slot object.Object) object.Object {
+	if slot == nothing {
+		return nil
+	}
+	return slot
+}
+
+// setParameters puts the arguments of a call into the slots of the
+// parameters, which come first in scope
+func setParameters(scope *object.Scope, args []object.Object) {
+	for i, arg := range args {
+		scope.Slots[i] = toSlot(arg)
+	}
+}
+
+// GlobalValue returns the value of the global variable at idx of globals,
+// which a vm has run with, and whether the variable has been defined
+func GlobalValue(globals []object.Object, idx int) (object.Object, bool) {
+	if globals[idx] == nil {
+		return nil, false
+	}
+	return fromSlot(globals[idx]), true
+}
+
+// lookupSlot finds the innermost defined variable called name, searching
+// scope and its outer scopes before the globals
+func (vm *VM) lookupSlot(scope *object.Scope, name string) *object.Object {
+	for s := scope; s != nil; s = s.Outer {
+		for i, n := range s.Names {
+			if n == name && s.Slots[i] != nil {
+				return &s.Slots[i]
+			}
+		}
+	}
+	for i, n := range vm.globalNames {
+		if n == name && vm.globals[i] != nil {
+			return &vm.globals[i]
+		}
+	}
+	return nil
+}
+
+func outerScope(scope *object.Scope, depth int) *object.Scope {
+	for ; depth > 0; depth-- {
+		scope = scope.Outer
+	}
+	return scope
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+// unquote copies the quoted template and replaces its placeholder
+// unquote(i) and unquote_splice(i) calls with the i-th value
+func unquote(template *object.Quote, values []object.Object) object.Object {
+	node, err := evaluator.Unquote(ast.Copy(template.Node), func(arg ast.Expression) object.Object {
+		placeholder, ok := arg.(*ast.IntegerLiteral)
+		if !ok || placeholder.Value >= int64(len(values)) {
+			return newError(object.ValueError, "invalid unquote placeholder %s", arg)
+		}
+		return values[placeholder.Value]
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) popFrame() *Frame {
+	frame := vm.currentFrame()
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	return frame
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func newError(kind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
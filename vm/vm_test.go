@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"context"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobalsState(t *testing.T) {
+	// like the REPL: every input is compiled and run on its own, sharing
+	// the symbol table, constants and globals of the earlier ones
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	inputs := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn() { g() + 1 };`, "<nothing>"},
+		{`f()`, "ERROR: 1:16: identifier not found: g\n  in f(), called at 1:1"},
+		{`let g = fn() { 41 };`, "<nothing>"},
+		{`f()`, "42"},
+		{`let x = 1; x += f(); x`, "43"},
+	}
+
+	for _, tt := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		got := inspect(NewWithGlobalsState(bytecode, globals).Run())
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	result := runVM(t, `let f = fn(n) { 1 + f(n + 1) }; f(0)`)
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error. got=%T (%+v)", result, result)
+	}
+	if !strings.Contains(err.Message, "stack overflow") {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+}
+
+func TestDeepRecursion(t *testing.T) {
+	result := runVM(t, `let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(100000)`)
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 5000050000 {
+		t.Errorf("wrong result. got=%s", inspect(result))
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{`1 + 2`, object.Limits{MaxSteps: 100}, "3"},
+		{`while (true) { }`, object.Limits{MaxSteps: 1000}, "ERROR: 1:1: step limit exceeded: 1000"},
+		{
+			`try { while (true) { } } catch (e) { 1 } finally { 2 }`,
+			object.Limits{MaxSteps: 100},
+			"ERROR: 1:7: step limit exceeded: 100",
+		},
+	}
+
+	for _, tt := range tests {
+		got := inspect(runVMContext(t, context.Background(), tt.input, tt.limits))
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := runVMContext(t, ctx, `while (true) { }`, object.Limits{})
+	if err, ok := result.(*object.Error); !ok || err.Kind != object.CancelledError {
+		t.Errorf("expected a cancelled error. got=%s", inspect(result))
+	}
+}
+
+func TestSetIO(t *testing.T) {
+	comp := compiler.New()
+	input := `let name = readline(); print("hello", name); eprint("bye"); readline()`
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var stdout, stderr strings.Builder
+	machine := New(comp.Bytecode())
+	machine.SetIO(object.NewIO(strings.NewReader("monkey\n"), &stdout, &stderr))
+
+	if result := machine.Run(); result != Null {
+		t.Errorf("wrong result. got=%s", inspect(result))
+	}
+	if stdout.String() != "hello monkey\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "bye\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+}
+
+func runVMContext(t *testing.T, ctx context.Context, input string, limits object.Limits) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(comp.Bytecode()).RunContext(ctx, limits)
+}